@@ -0,0 +1,69 @@
+// Package cli implements Mizan's subcommands, which operate on config files or on a running Mizan
+// without starting the load balancer
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// Exit codes returned by the subcommands
+const (
+	ExitOK      = 0
+	ExitInvalid = 1
+	ExitUsage   = 2
+)
+
+var commands = map[string]func(args []string, stdout, stderr io.Writer) int{
+	"validate": validate,
+	"diff":     diff,
+	"schema":   schema,
+	"history":  history,
+}
+
+// IsCommand reports whether name is a known subcommand
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the named subcommand and returns the exit code the process should exit with
+func Run(name string, args []string, stdout, stderr io.Writer) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", name)
+		return ExitUsage
+	}
+	return cmd(args, stdout, stderr)
+}
+
+func usage(stderr io.Writer, synopsis string) int {
+	fmt.Fprintf(stderr, "usage: mizan %s\n", synopsis)
+	return ExitUsage
+}
+
+// loadAndValidate loads the config at path and prints every validation problem found to stderr.
+// It returns the exit code to use when the config can't be used.
+func loadAndValidate(path string, stderr io.Writer) (*config.Config, int) {
+	conf, err := config.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, err)
+		return nil, ExitInvalid
+	}
+
+	if err := conf.Validate(); err != nil {
+		var verr *config.ValidationError
+		if !errors.As(err, &verr) {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return nil, ExitInvalid
+		}
+		for _, problem := range verr.Problems {
+			fmt.Fprintf(stderr, "%s: %s\n", path, problem)
+		}
+		return nil, ExitInvalid
+	}
+	return conf, ExitOK
+}
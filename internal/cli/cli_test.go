@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfig = `
+strategy: "rr"
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+`
+
+// writeConfig writes the given content to a temporary config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// run runs a subcommand and returns its exit code, stdout and stderr
+func run(name string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(name, args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Validate(t *testing.T) {
+	path := writeConfig(t, validConfig)
+	code, stdout, stderr := run("validate", path)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, path+" is valid\n", stdout)
+	assert.Empty(t, stderr)
+
+	path = writeConfig(t, `
+strategy: "random"
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+`)
+	code, stdout, stderr = run("validate", path)
+	assert.Equal(t, ExitInvalid, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, path+": unknown strategy")
+	assert.Contains(t, stderr, path+": service v1 has no replicas")
+
+	code, _, stderr = run("validate")
+	assert.Equal(t, ExitUsage, code)
+	assert.Equal(t, "usage: mizan validate <file>\n", stderr)
+}
+
+func TestRun_Diff(t *testing.T) {
+	from := writeConfig(t, validConfig)
+	to := writeConfig(t, `
+strategy: "wrr"
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+      - url: "http://localhost:9091"
+`)
+	code, stdout, stderr := run("diff", from, to)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "~ strategy: rr -> wrr\n+ services[\"/api/v1\"].replicas[\"http://localhost:9091\"]: weight 1\n", stdout)
+	assert.Empty(t, stderr)
+
+	code, stdout, _ = run("diff", from, from)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "No changes\n", stdout)
+
+	// An invalid new config would be rejected on reload
+	invalid := writeConfig(t, `strategy: "random"`)
+	code, stdout, _ = run("diff", from, invalid)
+	assert.Equal(t, ExitInvalid, code)
+	assert.Empty(t, stdout)
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	code, _, stderr := run("deploy")
+	assert.Equal(t, ExitUsage, code)
+	assert.Equal(t, "unknown command \"deploy\"\n", stderr)
+}
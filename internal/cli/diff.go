@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// diff prints the changes Mizan would apply when hot reloading from the old config to the new one.
+// The new config must be valid, since an invalid config would be rejected on reload.
+func diff(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		return usage(stderr, "diff <old> <new>")
+	}
+
+	oldConf, code := loadAndValidate(args[0], stderr)
+	if code != ExitOK {
+		return code
+	}
+	newConf, code := loadAndValidate(args[1], stderr)
+	if code != ExitOK {
+		return code
+	}
+
+	changes := config.Diff(oldConf, newConf)
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "No changes")
+		return ExitOK
+	}
+	for _, change := range changes {
+		fmt.Fprintln(stdout, newConf.Redact(oldConf.Redact(change.String())))
+	}
+	return ExitOK
+}
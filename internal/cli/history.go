@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	confighistory "github.com/Mo-Fatah/mizan/internal/pkg/history"
+)
+
+const (
+	historyUsage        = "history [-admin <address>] list|show <id>|rollback <id>"
+	defaultAdminAddress = "127.0.0.1:9900"
+)
+
+var adminClient = &http.Client{Timeout: 10 * time.Second}
+
+// history lists, shows and rolls back the configs applied by a running Mizan, through its admin API
+func history(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	admin := flags.String("admin", defaultAdminAddress, "Address of the admin API")
+	if err := flags.Parse(args); err != nil {
+		return usage(stderr, historyUsage)
+	}
+	baseUrl := "http://" + *admin + "/config/history"
+
+	args = flags.Args()
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		var snapshots []confighistory.SnapshotInfo
+		if err := callAdmin(http.MethodGet, baseUrl, &snapshots); err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitInvalid
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tHASH\tAPPLIED AT\tSOURCE\t")
+		for _, snapshot := range snapshots {
+			live := ""
+			if snapshot.Live {
+				live = "(live)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", snapshot.ID, snapshot.ShortHash(), snapshot.Timestamp.Format(time.RFC3339), snapshot.Source, live)
+		}
+		tw.Flush()
+	case len(args) == 2 && args[0] == "show":
+		var config string
+		if err := callAdmin(http.MethodGet, baseUrl+"/"+url.PathEscape(args[1]), &config); err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitInvalid
+		}
+		fmt.Fprint(stdout, config)
+	case len(args) == 2 && args[0] == "rollback":
+		var snapshot confighistory.SnapshotInfo
+		if err := callAdmin(http.MethodPost, baseUrl+"/"+url.PathEscape(args[1])+"/rollback", &snapshot); err != nil {
+			fmt.Fprintln(stderr, err)
+			return ExitInvalid
+		}
+		fmt.Fprintf(stdout, "Rolled back, the live config is now snapshot %d (%s)\n", snapshot.ID, snapshot.ShortHash())
+	default:
+		return usage(stderr, historyUsage)
+	}
+	return ExitOK
+}
+
+// callAdmin calls the admin API, decoding JSON responses into out, or copying them as is if out is a string
+func callAdmin(method, adminUrl string, out interface{}) error {
+	req, err := http.NewRequest(method, adminUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := adminClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("admin API: %s", apiErr.Error)
+		}
+		return fmt.Errorf("admin API: %s", strings.TrimSpace(string(body)))
+	}
+
+	if s, ok := out.(*string); ok {
+		*s = string(body)
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAdmin serves a history of two snapshots, the second one being live, and records the escaped paths it's called with
+func fakeAdmin(t *testing.T) (string, *[]string) {
+	paths := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.EscapedPath())
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /config/history":
+			w.Write([]byte(`[
+				{"id": 1, "hash": "0123456789abcdef", "timestamp": "2024-01-02T03:04:05Z", "source": "config.yml"},
+				{"id": 2, "hash": "abc", "timestamp": "2024-01-02T04:04:05Z", "source": "config.yml", "live": true}
+			]`))
+		case "GET /config/history/1":
+			w.Write([]byte("strategy: rr\n"))
+		case "POST /config/history/1/rollback":
+			w.Write([]byte(`{"id": 3, "hash": "fedcba9876543210", "timestamp": "2024-01-02T05:04:05Z", "source": "rollback to snapshot 1", "live": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "snapshot not found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://"), &paths
+}
+
+func TestRun_History(t *testing.T) {
+	admin, paths := fakeAdmin(t)
+
+	code, stdout, _ := run("history", "-admin", admin, "list")
+	assert.Equal(t, ExitOK, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Contains(t, lines[1], "0123456789ab ")
+		// A hash shorter than usual is printed as is
+		assert.Contains(t, lines[2], "abc ")
+		assert.Contains(t, lines[2], "(live)")
+	}
+
+	code, stdout, _ = run("history", "-admin", admin, "show", "1")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "strategy: rr\n", stdout)
+
+	code, stdout, _ = run("history", "-admin", admin, "rollback", "1")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "Rolled back, the live config is now snapshot 3 (fedcba987654)\n", stdout)
+
+	code, stdout, stderr := run("history", "-admin", admin, "rollback", "42")
+	assert.Equal(t, ExitInvalid, code)
+	assert.Empty(t, stdout)
+	assert.Equal(t, "admin API: snapshot not found\n", stderr)
+
+	// References are escaped rather than changing the path or adding a query
+	code, _, _ = run("history", "-admin", admin, "show", "../1?x=y")
+	assert.Equal(t, ExitInvalid, code)
+	assert.Equal(t, []string{
+		"GET /config/history",
+		"GET /config/history/1",
+		"POST /config/history/1/rollback",
+		"POST /config/history/42/rollback",
+		"GET /config/history/..%2F1%3Fx=y",
+	}, *paths)
+
+	code, _, stderr = run("history", "-admin", admin, "rollback")
+	assert.Equal(t, ExitUsage, code)
+	assert.Equal(t, "usage: mizan "+historyUsage+"\n", stderr)
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// schema prints the JSON Schema of the config files
+func schema(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		return usage(stderr, "schema")
+	}
+
+	schema, err := config.JSONSchema()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitInvalid
+	}
+	fmt.Fprintln(stdout, string(schema))
+	return ExitOK
+}
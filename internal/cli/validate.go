@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+)
+
+// validate loads and validates a config file, exiting with a non-zero code if it's invalid
+func validate(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		return usage(stderr, "validate <file>")
+	}
+
+	if _, code := loadAndValidate(args[0], stderr); code != ExitOK {
+		return code
+	}
+	fmt.Fprintf(stdout, "%s is valid\n", args[0])
+	return ExitOK
+}
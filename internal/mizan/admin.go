@@ -0,0 +1,172 @@
+package mizan
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/breaker"
+	"github.com/Mo-Fatah/mizan/internal/pkg/history"
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	log "github.com/sirupsen/logrus"
+)
+
+// startAdminServer starts the admin API, which exposes:
+//   - GET /config/history: the list of applied configs
+//   - GET /config/history/{id or hash}: the YAML of an applied config
+//   - POST /config/history/{id or hash}/rollback: applies a previous config
+//   - GET /connections/upgraded: the number of open upgraded connections by replica
+//   - GET /connections/tcp: the counters of the TCP connections by replica
+//   - GET /connections/udp: the counters of the UDP sessions by replica
+//   - GET /breakers: the circuit breakers of the replicas by service
+//   - GET /metrics: the metrics in the Prometheus text format
+func (m *Mizan) startAdminServer(address string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config/history", m.handleHistoryList)
+	mux.HandleFunc("/config/history/", m.handleHistorySnapshot)
+	mux.HandleFunc("/connections/upgraded", m.handleUpgradedConnections)
+	mux.HandleFunc("/connections/tcp", m.handleL4Connections("tcp"))
+	mux.HandleFunc("/connections/udp", m.handleL4Connections("udp"))
+	mux.HandleFunc("/breakers", m.handleBreakers)
+	mux.HandleFunc("/metrics", m.handleMetrics)
+
+	m.mizanLock.Lock()
+	m.adminServer = &http.Server{
+		Addr:    address,
+		Handler: mux,
+	}
+	server := m.adminServer
+	m.mizanLock.Unlock()
+
+	log.Info("Starting admin API on ", address)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err)
+	}
+}
+
+func (m *Mizan) handleHistoryList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	m.applyLock.Lock()
+	live := m.liveSnapshotID
+	m.applyLock.Unlock()
+
+	snapshots := make([]history.SnapshotInfo, 0)
+	for _, snapshot := range m.history.List() {
+		snapshots = append(snapshots, history.SnapshotInfo{Snapshot: snapshot, Live: snapshot.ID == live})
+	}
+	writeAdminJSON(w, http.StatusOK, snapshots)
+}
+
+func (m *Mizan) handleUpgradedConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, m.upgrades.counts())
+}
+
+// handleL4Connections serves the counters of the replicas of the given network, udp ones being the only replicas with udp urls
+func (m *Mizan) handleL4Connections(network string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		m.mizanLock.Lock()
+		counters := make(map[string]l4.Counters)
+		for replica, replicaCounters := range m.l4Counters {
+			if strings.HasPrefix(replica, "udp://") == (network == "udp") {
+				counters[replica] = replicaCounters.Snapshot()
+			}
+		}
+		m.mizanLock.Unlock()
+		writeAdminJSON(w, http.StatusOK, counters)
+	}
+}
+
+// handleBreakers serves the circuit breakers of the replicas keyed by service name then replica url,
+// services without circuit breakers being left out
+func (m *Mizan) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	m.mizanLock.Lock()
+	breakers := make(map[string]map[string]breaker.Snapshot)
+	for _, svc := range m.services {
+		for _, server := range svc.servers {
+			if server.GetBreaker() == nil {
+				continue
+			}
+			if breakers[svc.config.Name] == nil {
+				breakers[svc.config.Name] = make(map[string]breaker.Snapshot)
+			}
+			breakers[svc.config.Name][server.GetUrl().String()] = server.GetBreaker().Snapshot()
+		}
+	}
+	m.mizanLock.Unlock()
+	writeAdminJSON(w, http.StatusOK, breakers)
+}
+
+func (m *Mizan) handleHistorySnapshot(w http.ResponseWriter, r *http.Request) {
+	// The escaped path is split so that an escaped slash stays in the reference
+	ref, action, _ := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/config/history/"), "/")
+	ref, err := url.PathUnescape(ref)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		snapshot, err := m.history.Get(ref)
+		if err != nil {
+			writeAdminError(w, statusOf(err), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write([]byte(snapshot.Config))
+	case action == "rollback" && r.Method == http.MethodPost:
+		snapshot, err := m.Rollback(ref)
+		if err != nil {
+			writeAdminError(w, statusOf(err), err)
+			return
+		}
+		if snapshot == nil {
+			writeAdminError(w, http.StatusInternalServerError, errors.New("config rolled back but not recorded in history"))
+			return
+		}
+		info := history.SnapshotInfo{Snapshot: *snapshot, Live: true}
+		info.Config = ""
+		writeAdminJSON(w, http.StatusOK, info)
+	case action == "" || action == "rollback":
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		writeAdminError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func statusOf(err error) int {
+	if errors.Is(err, history.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Error while writing admin API response: %s", err)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
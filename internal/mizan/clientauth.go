@@ -0,0 +1,85 @@
+package mizan
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/tlsconfig"
+)
+
+type contextKey int
+
+// listenerKey is the key of the listener a request was received on in the request context
+const listenerKey contextKey = iota
+
+// withListener returns a ConnContext that records the listener the connections are accepted on
+func withListener(listener config.Listener) func(context.Context, net.Conn) context.Context {
+	return func(ctx context.Context, _ net.Conn) context.Context {
+		return context.WithValue(ctx, listenerKey, listener)
+	}
+}
+
+func listenerOf(r *http.Request) (config.Listener, bool) {
+	listener, ok := r.Context().Value(listenerKey).(config.Listener)
+	return listener, ok
+}
+
+// requestClientCerts makes a TLS listener without client authentication of its own ask clients for
+// their certificates whenever a service authenticates clients, leaving their verification to the services
+func (m *Mizan) requestClientCerts(c *tls.Config) {
+	requesting := c.Clone()
+	requesting.ClientAuth = tls.RequestClientCert
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		if m.authenticatesClients() {
+			return requesting, nil
+		}
+		return nil, nil
+	}
+}
+
+func (m *Mizan) authenticatesClients() bool {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	for _, svc := range m.services {
+		if svc.clientAuth != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateClient enforces the client authentication of the service on the request, and forwards
+// the identity of the client to the backend in the headers of the service, or else of the listener
+func (m *Mizan) authenticateClient(r *http.Request, svc *service) error {
+	var certs []*x509.Certificate
+	verified := false
+	if r.TLS != nil {
+		certs = r.TLS.PeerCertificates
+		verified = len(r.TLS.VerifiedChains) > 0
+	}
+
+	var headers config.ClientIdentityHeaders
+	if listener, ok := listenerOf(r); ok && listener.TLS != nil && listener.TLS.ClientAuth != nil {
+		headers = listener.TLS.ClientAuth.Headers
+	}
+	if svc.clientAuth != nil {
+		serviceVerified, err := svc.clientAuth.Verify(certs)
+		if err != nil {
+			return err
+		}
+		verified = verified || serviceVerified
+		if names := svc.config.ClientAuth.Headers; len(names.Names()) > 0 {
+			// The headers of the listener are stripped all the same, they must never come from clients
+			for _, name := range headers.Names() {
+				r.Header.Del(name)
+			}
+			headers = names
+		}
+	}
+	tlsconfig.SetIdentityHeaders(r.Header, headers, certs, verified)
+	return nil
+}
@@ -0,0 +1,39 @@
+package mizan
+
+import (
+	"context"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/limiter"
+)
+
+// acquire picks the replica of a request, waiting in the queue of the service if it's over its concurrency limits,
+// as far as the priority of the request allows. The returned release func must be called once the request has been proxied.
+func (svc *service) acquire(ctx context.Context, priority limiter.Priority) (*common.Server, func(), error) {
+	if svc.limiter == nil {
+		server, err := svc.balancer.Next()
+		return server, func() {}, err
+	}
+	var server *common.Server
+	err := svc.limiter.Acquire(ctx, priority, func() error {
+		var err error
+		if server, err = svc.balancer.Next(); err != nil && svc.busy() {
+			return limiter.ErrBusy
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return server, svc.limiter.Release, nil
+}
+
+// busy tells whether a replica of the service is alive but has no room for another request, which is worth waiting for
+func (svc *service) busy() bool {
+	for _, server := range svc.servers {
+		if server.Busy() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package mizan
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// connTracker tracks long-lived connections that the HTTP servers neither time out nor wait for on shutdown,
+// such as upgraded and TCP ones, by the url of the replica they're proxied to
+type connTracker struct {
+	mu *sync.Mutex
+	// kind describes the connections in logs
+	kind  string
+	conns map[string]map[*trackedConn]struct{}
+}
+
+func newConnTracker(kind string) *connTracker {
+	return &connTracker{
+		mu:    &sync.Mutex{},
+		kind:  kind,
+		conns: make(map[string]map[*trackedConn]struct{}),
+	}
+}
+
+// counts returns the number of open connections by replica
+func (t *connTracker) counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int)
+	for replica, conns := range t.conns {
+		counts[replica] = len(conns)
+	}
+	return counts
+}
+
+// track tracks a connection proxied to a replica, which is closed once it's been idle for idleTimeout
+func (t *connTracker) track(conn net.Conn, replica string, idleTimeout time.Duration) *trackedConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := &trackedConn{
+		Conn:        conn,
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+		once:        &sync.Once{},
+	}
+	c.onClose = func() { t.untrack(c, replica) }
+	// Replaces any deadline set by the HTTP server for the request, which would cut the connection short
+	c.extend()
+	if t.conns[replica] == nil {
+		t.conns[replica] = make(map[*trackedConn]struct{})
+	}
+	t.conns[replica][c] = struct{}{}
+	log.Infof("Opened %s connection to %s, %d open", t.kind, replica, len(t.conns[replica]))
+	return c
+}
+
+func (t *connTracker) untrack(c *trackedConn, replica string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns[replica], c)
+	if len(t.conns[replica]) == 0 {
+		delete(t.conns, replica)
+	}
+	log.Infof("Closed %s connection to %s, %d open", t.kind, replica, len(t.conns[replica]))
+}
+
+// drain waits for the connections to the replicas accepted by the filter to finish,
+// and closes the ones that are still open once the timeout has passed
+func (t *connTracker) drain(filter func(replica string) bool, timeout time.Duration) {
+	t.mu.Lock()
+	conns := make([]*trackedConn, 0)
+	for replica, replicaConns := range t.conns {
+		if !filter(replica) {
+			continue
+		}
+		for c := range replicaConns {
+			conns = append(conns, c)
+		}
+	}
+	t.mu.Unlock()
+	if len(conns) == 0 {
+		return
+	}
+
+	log.Infof("Draining %d %s connections", len(conns), t.kind)
+	deadline := time.After(timeout)
+	for _, c := range conns {
+		select {
+		case <-c.done:
+		case <-deadline:
+			// Once the timeout has passed, the remaining connections are closed right away
+			deadline = closed
+			c.Close()
+		}
+	}
+}
+
+// closed is always ready to receive from
+var closed = func() <-chan time.Time {
+	ch := make(chan time.Time)
+	close(ch)
+	return ch
+}()
+
+// trackedConn is closed once it's been idle for the idle timeout, traffic in either direction keeps it open
+type trackedConn struct {
+	net.Conn
+	idleTimeout time.Duration
+	// done is closed once the connection is closed
+	done    chan struct{}
+	once    *sync.Once
+	onClose func()
+}
+
+func (c *trackedConn) extend() {
+	c.Conn.SetDeadline(time.Now().Add(c.idleTimeout))
+}
+
+func (c *trackedConn) Read(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Read(b)
+}
+
+func (c *trackedConn) Write(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Write(b)
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		close(c.done)
+		c.onClose()
+	})
+	return err
+}
+
+// NetConn returns the tracked connection
+func (c *trackedConn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,43 @@
+package mizan
+
+import (
+	"fmt"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/history"
+	log "github.com/sirupsen/logrus"
+)
+
+// recordConfig records an applied config in the config history, and returns its snapshot.
+// Failing to record a config doesn't prevent it from being applied.
+func (m *Mizan) recordConfig(conf *config.Config, source string) *history.Snapshot {
+	data, err := conf.Marshal()
+	if err != nil {
+		log.Errorf("Error while recording config in history: %s", err)
+		return nil
+	}
+	snapshot, err := m.history.Record(data, source)
+	if err != nil {
+		log.Errorf("Error while recording config in history: %s", err)
+		return nil
+	}
+	m.liveSnapshotID = snapshot.ID
+	log.Infof("Applied config snapshot %d (%s) from %s", snapshot.ID, snapshot.ShortHash(), source)
+	return snapshot
+}
+
+// Rollback applies the config of a previous snapshot, referenced by its id or a prefix of its hash.
+// The config file is left untouched, the next change to it is applied as usual.
+func (m *Mizan) Rollback(ref string) (*history.Snapshot, error) {
+	snapshot, err := m.history.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := config.Parse([]byte(snapshot.Config), config.YAML)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading snapshot %d: %w", snapshot.ID, err)
+	}
+
+	log.Infof("Rolling back to config snapshot %d", snapshot.ID)
+	return m.applyConfig(conf, fmt.Sprintf("rollback to snapshot %d", snapshot.ID))
+}
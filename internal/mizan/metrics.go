@@ -0,0 +1,95 @@
+package mizan
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// metric is a metric family in the Prometheus text format
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	samples []sample
+}
+
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+func (m *metric) add(value float64, labels ...[2]string) {
+	m.samples = append(m.samples, sample{labels: labels, value: value})
+}
+
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	for _, s := range m.samples {
+		labels := make([]string, 0, len(s.labels))
+		for _, label := range s.labels {
+			labels = append(labels, fmt.Sprintf("%s=%q", label[0], label[1]))
+		}
+		fmt.Fprintf(w, "%s{%s} %g\n", m.name, strings.Join(labels, ","), s.value)
+	}
+}
+
+// handleMetrics serves the metrics of the HTTP services and their replicas in the Prometheus text format
+func (m *Mizan) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	up := &metric{name: "mizan_replica_up", help: "Whether the replica is found alive by the health checks.", kind: "gauge"}
+	state := &metric{name: "mizan_circuit_breaker_state", help: "State of the circuit breaker of the replica: 0 closed, 1 open, 2 half-open.", kind: "gauge"}
+	trips := &metric{name: "mizan_circuit_breaker_trips_total", help: "Number of times the circuit breaker of the replica opened.", kind: "counter"}
+	replicaInFlight := &metric{name: "mizan_replica_in_flight", help: "Requests in flight to the replica, counted if they're limited.", kind: "gauge"}
+	inFlight := &metric{name: "mizan_service_in_flight", help: "Requests in flight to the service, counted if they're limited.", kind: "gauge"}
+	queued := &metric{name: "mizan_service_queued", help: "Requests waiting in the queue of the service.", kind: "gauge"}
+	limit := &metric{name: "mizan_service_concurrency_limit", help: "Requests allowed in flight to the service, adjusted to the latency if adaptive.", kind: "gauge"}
+
+	m.mizanLock.Lock()
+	matchers := make([]string, 0, len(m.services))
+	for matcher := range m.services {
+		matchers = append(matchers, matcher)
+	}
+	sort.Strings(matchers)
+	for _, matcher := range matchers {
+		svc := m.services[matcher]
+		if svc.limiter != nil {
+			inFlight.add(float64(svc.limiter.InFlight()), [2]string{"service", svc.config.Name})
+			queued.add(float64(svc.limiter.Queued()), [2]string{"service", svc.config.Name})
+			if max := svc.limiter.Max(); max > 0 {
+				limit.add(float64(max), [2]string{"service", svc.config.Name})
+			}
+		}
+		for _, server := range svc.servers {
+			labels := [][2]string{{"service", svc.config.Name}, {"replica", server.GetUrl().String()}}
+			up.add(boolValue(server.IsAlive()), labels...)
+			if svc.limiter != nil {
+				replicaInFlight.add(float64(server.InFlight()), labels...)
+			}
+			if b := server.GetBreaker(); b != nil {
+				snapshot := b.Snapshot()
+				state.add(float64(snapshot.State), labels...)
+				trips.add(float64(snapshot.Trips), labels...)
+			}
+		}
+	}
+	m.mizanLock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, metric := range []*metric{up, state, trips, replicaInFlight, inFlight, queued, limit} {
+		metric.write(w)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package mizan
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -9,32 +10,65 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
-	"time"
 
-	balancer "github.com/Mo-Fatah/mizan/internal/pkg/balancer"
 	"github.com/Mo-Fatah/mizan/internal/pkg/common"
 	"github.com/Mo-Fatah/mizan/internal/pkg/config"
 	"github.com/Mo-Fatah/mizan/internal/pkg/health"
-	"github.com/fsnotify/fsnotify"
+	"github.com/Mo-Fatah/mizan/internal/pkg/history"
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	"github.com/Mo-Fatah/mizan/internal/pkg/limiter"
+	"github.com/Mo-Fatah/mizan/internal/pkg/proxyproto"
+	"github.com/Mo-Fatah/mizan/internal/pkg/ratelimit"
+	"github.com/Mo-Fatah/mizan/internal/pkg/retry"
+	"github.com/Mo-Fatah/mizan/internal/pkg/tlsconfig"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Mizan struct {
 	// a general mutex to be used for locking operations on Mizan
 	mizanLock *sync.Mutex
+	// serializes applying configs, which may come from the config file or from a rollback
+	applyLock *sync.Mutex
 	// The reader from which the config is loaded
 	configPath string
 	// The configuration loaded from the config file
-	// TODO (Mo-Fatah): Should add hot reload for config
 	config *config.Config
-	// Servers is a map of service matcher to a list of servers/replicas
-	serversMap map[string]balancer.Balancer
-	// Ports to which Mizan will listen on
-	ports []int
+	// Services is a map of service matcher to the service and its servers/replicas
+	services map[string]*service
+	// Listeners on which Mizan will listen on, built from the ports and listeners of the config
+	listeners []config.Listener
 	// The channel through which Mizan will receive signals to shutdown
 	shutdownCh chan struct{}
 	// The channel through which Mizan will receive signals to reload config
 	reloadCh chan struct{}
+	// The channel through which the config watcher is notified that a new config has been applied
+	appliedCh chan struct{}
+	// Closed on shutdown to stop the config watcher and reloader
+	stopCh chan struct{}
+	// Shuts Mizan down once, however many times ShutDown is called
+	shutdownOnce *sync.Once
+	// The configs applied so far, and the id of the snapshot of the live one
+	history        *history.History
+	liveSnapshotID int
+	// The admin API server, nil if the admin API is disabled
+	adminServer *http.Server
+	// The connections upgraded from HTTP, such as WebSockets
+	upgrades *connTracker
+	// TCP services keyed by their port, the addresses they're served on keyed by port and the connections proxied to them
+	tcpServices  map[int]*tcpService
+	tcpAddresses map[int]string
+	tcpConns     *connTracker
+	// UDP services keyed by their port, and the addresses they're served on keyed by port
+	udpServices  map[int]*udpService
+	udpAddresses map[int]string
+	// Counters of the TCP connections and UDP sessions keyed by replica url, kept across reloads
+	l4Counters map[string]*l4.Counters
+	// Caps the retries of all the services
+	retryBudget *retry.Budget
+	// Keeps the state of the rate limits of all the services, in memory unless set with SetRateLimitStore
+	rateLimitStore ratelimit.Store
 
 	maxConnections uint32
 
@@ -48,26 +82,60 @@ func NewMizan(configPath string) *Mizan {
 	if err != nil {
 		log.Fatalf("Error while loading config: %s", err)
 	}
+	installRedactor.Do(func() { log.AddHook(redactor) })
+	redactor.add(conf)
+	if err := conf.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-	var ports []int
-	if conf.Ports == nil || len(conf.Ports) == 0 {
-		ports = []int{433}
-	} else {
-		ports = conf.Ports
+	configHistory, err := history.New(conf.History.Limit, conf.History.Dir)
+	if err != nil {
+		log.Fatalf("Error while loading config history: %s", err)
+	}
+
+	listeners := conf.AllListeners()
+	if len(listeners) == 0 && len(conf.Services) > 0 {
+		log.Warn("No ports or listeners are configured, the services won't be served")
+	}
+	tcpAddresses := make(map[int]string)
+	for _, service := range conf.TCP {
+		tcpAddresses[service.Port] = service.ListenAddress()
+	}
+	udpAddresses := make(map[int]string)
+	for _, service := range conf.UDP {
+		udpAddresses[service.Port] = service.ListenAddress()
 	}
 
 	return &Mizan{
 		configPath:     configPath,
 		config:         conf,
-		ports:          ports,
+		listeners:      listeners,
 		shutdownCh:     shutdownCh,
 		reloadCh:       reloadCh,
+		appliedCh:      make(chan struct{}, 1),
+		stopCh:         make(chan struct{}),
+		shutdownOnce:   &sync.Once{},
 		mizanLock:      &sync.Mutex{},
+		applyLock:      &sync.Mutex{},
+		history:        configHistory,
+		upgrades:       newConnTracker("upgraded"),
+		tcpAddresses:   tcpAddresses,
+		tcpConns:       newConnTracker("tcp"),
+		udpAddresses:   udpAddresses,
+		l4Counters:     make(map[string]*l4.Counters),
+		retryBudget:    retry.NewBudget(conf.RetryBudget.PercentOrDefault(), conf.RetryBudget.MinPerSecondOrDefault()),
+		rateLimitStore: ratelimit.NewMemoryStore(),
 		maxConnections: conf.MaxConnections,
 		connections:    0,
 	}
 }
 
+// SetRateLimitStore sets the store of the rate limits, e.g. a store shared by several Mizan instances.
+// It must be called before Start.
+func (m *Mizan) SetRateLimitStore(store ratelimit.Store) {
+	m.rateLimitStore = store
+}
+
 // Start starts:
 // 1. The config watcher
 // 3. The health checker for each service
@@ -77,13 +145,26 @@ func (m *Mizan) Start() {
 		log.Fatalf("Error while building servers map: %s", err)
 	}
 
+	if m.config.Admin.Address != "" {
+		go m.startAdminServer(m.config.Admin.Address)
+	}
+
 	log.Info("Starting Config Watcher")
+	go m.cfgReloader()
 	go m.cfgWatcher()
 
 	wg := &sync.WaitGroup{}
-	for _, port := range m.ports {
+	for _, listener := range m.listeners {
+		wg.Add(1)
+		go m.startHttpServer(listener, wg)
+	}
+	for port, address := range m.tcpAddresses {
 		wg.Add(1)
-		go m.startHttpServer(port, wg)
+		go m.startTCPServer(port, address, wg)
+	}
+	for port, address := range m.udpAddresses {
+		wg.Add(1)
+		go m.startUDPServer(port, address, wg)
 	}
 	wg.Wait()
 }
@@ -100,121 +181,210 @@ func (m *Mizan) cfgController() error {
 		log.Errorf("Error while loading config: %s", err)
 		return err
 	}
+	_, err = m.applyConfig(newConfig, m.configPath)
+	return err
+}
+
+// applyConfig validates the config, swaps it with the live one and records it in the config history.
+// source tells where the config came from, and is recorded along with it.
+func (m *Mizan) applyConfig(newConfig *config.Config, source string) (*history.Snapshot, error) {
+	m.applyLock.Lock()
+	defer m.applyLock.Unlock()
+
+	redactor.add(newConfig)
+	// An invalid config is never applied, Mizan keeps serving with the current one
+	if err := newConfig.Validate(); err != nil {
+		log.Errorf("Rejecting config: %s", err)
+		return nil, err
+	}
+	if m.services != nil {
+		for _, change := range config.Diff(m.config, newConfig) {
+			log.Infof("Config change: %s", change)
+		}
+	}
+	newServices, err := buildServices(newConfig, m.services)
+	if err != nil {
+		log.Errorf("Rejecting config: %s", err)
+		return nil, err
+	}
+	newTCPServices := buildTCPServices(newConfig)
+	newUDPServices := buildUDPServices(newConfig)
+
 	// If this the first time the config is loaded then we should skip shutting down the health checker
 	// otherwise, we need to shutdown the health checkers of the old services
-	if m.serversMap != nil {
-		for _, service := range m.serversMap {
-			service.HealthChecker().ShutDown()
+	if m.services != nil {
+		for _, service := range m.services {
+			service.balancer.HealthChecker().ShutDown()
+		}
+		for _, service := range m.tcpServices {
+			service.balancer.HealthChecker().ShutDown()
+		}
+		for _, service := range m.udpServices {
+			service.balancer.HealthChecker().ShutDown()
 		}
 	}
 
-	newServersMap := buildServersMap(newConfig)
-
 	m.mizanLock.Lock()
+	oldTCPServices := m.tcpServices
 	m.config = newConfig
-	m.serversMap = newServersMap
+	m.services = newServices
+	m.tcpServices = newTCPServices
+	m.udpServices = newUDPServices
 	m.mizanLock.Unlock()
+	m.retryBudget.SetLimits(newConfig.RetryBudget.PercentOrDefault(), newConfig.RetryBudget.MinPerSecondOrDefault())
 
-	// Start health checker
-	for _, serviceBalancer := range newServersMap {
-		go serviceBalancer.HealthChecker().Start()
+	// The connections to the replicas that have been removed are drained, the others are kept open
+	replicas := make(map[string]bool)
+	for _, service := range newConfig.Services {
+		for _, replica := range service.Replicas {
+			replicas[replica.Url] = true
+		}
 	}
-	return nil
-}
+	go m.upgrades.drain(func(replica string) bool { return !replicas[replica] }, newConfig.Upgrades.DrainTimeoutOrDefault())
+	drainTCPServices(m.tcpConns, oldTCPServices, newTCPServices)
 
-func (m *Mizan) cfgWatcher() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
+	select {
+	case m.appliedCh <- struct{}{}:
+	default:
 	}
-	watcher.Add(m.configPath)
-outer:
-	for {
-		start := time.Now()
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				log.Error("Error while watching config file")
-				continue
-			}
-			if event.Has(fsnotify.Write) {
-				// A signle write event can produce multiple write signals
-				// This is a hack to avoid double reloads
-				// TODO (Mo-Fatah): Find a better way to deduplicate write events
-				if time.Since(start) < 100*time.Microsecond {
-					continue
-				}
-				log.Info("Config file has been modified. Reloading config")
-				go m.cfgController()
-			}
 
-			if event.Has(fsnotify.Remove) {
-				log.Error("The config file has been removed. Shutting down Config Watcher")
-				break outer
-			}
-		case err := <-watcher.Errors:
-			log.Errorf("Error while watching config file: %s", err)
-		}
+	// Start health checker
+	for _, service := range newServices {
+		go service.balancer.HealthChecker().Start()
+	}
+	for _, service := range newTCPServices {
+		go service.balancer.HealthChecker().Start()
 	}
+	for _, service := range newUDPServices {
+		go service.balancer.HealthChecker().Start()
+	}
+	return m.recordConfig(newConfig, source), nil
 }
 
-func (m *Mizan) incrementConnections() {
-	atomic.AddUint32(&m.connections, 1)
+// tryIncrementConnections counts a connection if it's under the share of max_connections it can use, and tells whether it is.
+// The check and the increment are a single atomic step, so that concurrent connections can't overshoot the limit.
+func (m *Mizan) tryIncrementConnections(share float64) bool {
+	max := uint32(float64(m.getConfig().MaxConnections) * share)
+	for {
+		connections := atomic.LoadUint32(&m.connections)
+		if connections >= max {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(&m.connections, connections, connections+1) {
+			return true
+		}
+	}
 }
 
+// decrementConnections uncounts a connection counted by tryIncrementConnections
 func (m *Mizan) decrementConnections() {
-	// TODO (Mo-Fatah): There a chance of underflow here. Investigate
-	if connections := atomic.LoadUint32(&m.connections); connections > 0 {
-		atomic.AddUint32(&m.connections, ^uint32(0))
-	}
+	atomic.AddUint32(&m.connections, ^uint32(0))
 }
 
-func buildServersMap(conf *config.Config) map[string]balancer.Balancer {
-	serversMap := make(map[string]balancer.Balancer)
-	for _, service := range conf.Services {
-		servers := make([]*common.Server, 0)
-		for _, replica := range service.Replicas {
-			server := common.NewServer(replica, service.Name)
-			servers = append(servers, server)
+func (m *Mizan) IsReady() bool {
+	for _, listener := range m.listeners {
+		if !isListening(listener.NetworkOrDefault(), dialAddress(listener.ListenAddress())) {
+			return false
 		}
-		serversMap[service.Matcher] = newBalancer(servers, conf.Strategy)
-		serversMap[service.Matcher].SetHealthChecker(health.NewHealthChecker(servers, service.Name))
 	}
-	return serversMap
+	for _, address := range m.tcpAddresses {
+		if !isListening("tcp", dialAddress(address)) {
+			return false
+		}
+	}
+	return true
 }
 
-func newBalancer(servers []*common.Server, strategy string) balancer.Balancer {
-	switch strings.ToLower(strategy) {
-	case "rr":
-		return balancer.NewRR(servers)
-	case "wrr":
-		return balancer.NewWRR(servers)
-	default:
-		return balancer.NewRR(servers)
+// dialAddress returns the address to dial to reach a listen address, which may have no host or the unspecified one
+func dialAddress(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// e.g. the path of a Unix domain socket
+		return address
 	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		// Dialing the unspecified address dials the local system, as dialing an empty host does
+		return ":" + port
+	}
+	return address
 }
 
-func (m *Mizan) IsReady() bool {
-	for _, port := range m.ports {
-		_, err := net.Dial("tcp", fmt.Sprintf(":%d", port))
-		if err != nil {
+// IsHealthChecked tells whether the replicas of every service have been health checked once since the config was applied,
+// so that the replicas that are up are known to be alive
+func (m *Mizan) IsHealthChecked() bool {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	checkers := make([]*health.HealthChecker, 0)
+	for _, svc := range m.services {
+		checkers = append(checkers, svc.balancer.HealthChecker())
+	}
+	for _, svc := range m.tcpServices {
+		checkers = append(checkers, svc.balancer.HealthChecker())
+	}
+	for _, svc := range m.udpServices {
+		checkers = append(checkers, svc.balancer.HealthChecker())
+	}
+	for _, checker := range checkers {
+		if !checker.Checked() {
 			return false
 		}
 	}
 	return true
 }
 
-func (m *Mizan) startHttpServer(port int, wg *sync.WaitGroup) {
+func isListening(network, address string) bool {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (m *Mizan) getConfig() *config.Config {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	return m.config
+}
+
+func (m *Mizan) startHttpServer(listener config.Listener, wg *sync.WaitGroup) {
 	defer wg.Done()
-	log.Info("Starting http server on port ", port)
+	log.Info("Starting http server on ", listener.Name())
 	// Timeouts are set to avoid Slowloris attacks. Values are subjectively chosen.
 	// see: https://blog.cloudflare.com/the-complete-guide-to-golang-net-http-timeouts/
 	server := http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      m,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		Handler:           m,
+		ReadTimeout:       listener.Timeouts.ReadOrDefault(),
+		ReadHeaderTimeout: listener.Timeouts.ReadHeader,
+		WriteTimeout:      listener.Timeouts.WriteOrDefault(),
+		IdleTimeout:       listener.Timeouts.IdleOrDefault(),
+		ConnContext:       withListener(listener),
+	}
+	if listener.Protocol == config.HTTP1 {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	if listener.ServesH2C() {
+		server.Handler = h2c.NewHandler(m, &http2.Server{IdleTimeout: server.IdleTimeout})
+	}
+	var tlsConfig *tls.Config
+	if listener.TLS != nil {
+		var certStore *tlsconfig.CertStore
+		var err error
+		tlsConfig, certStore, err = tlsconfig.NewServerConfig(listener.TLS)
+		if err != nil {
+			log.Fatalf("Error while setting up TLS on %s: %s", listener.Name(), err)
+		}
+		if listener.Protocol == config.HTTP1 && len(listener.TLS.ALPN) == 0 {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+		if listener.TLS.ClientAuth == nil {
+			m.requestClientCerts(tlsConfig)
+		}
+		go certStore.Watch(m.stopCh)
+		// net/http offers HTTP/2 unless it's told not to, which it should be if ALPN is set without it
+		if len(listener.TLS.ALPN) > 0 && !containsString(listener.TLS.ALPN, "h2") {
+			server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
 	}
 
 	go func() {
@@ -223,70 +393,210 @@ func (m *Mizan) startHttpServer(port int, wg *sync.WaitGroup) {
 		if err := server.Shutdown(context.TODO()); err != nil {
 			log.Error(err)
 		}
-		log.Info("Shutting down server on port ", port)
+		log.Info("Shutting down server on ", listener.Name())
 		// Send shutdown complete signal
 		m.shutdownCh <- struct{}{}
 	}()
 
-	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	ln, err := listen(listener)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if listener.ProxyProtocol != nil {
+		// The header comes before the TLS handshake
+		ln = proxyproto.NewListener(ln, listener.ProxyProtocol.TrustedNets(), listener.ProxyProtocol.HeaderTimeoutOrDefault())
+	}
+	if tlsConfig != nil {
+		// TLS is terminated here rather than by net/http, which only offers its ALPN protocols
+		// in its own copy of the config, not in the configs returned by GetConfigForClient
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	err = server.Serve(ln)
+	if !errors.Is(err, http.ErrServerClosed) {
 		log.Error(err)
 	}
 }
 
-func (m *Mizan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if m.connections >= m.config.MaxConnections {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		log.Error("Max connections reached")
-		return
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
+	return false
+}
 
-	m.incrementConnections()
-	defer m.decrementConnections()
-
+func (m *Mizan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	service := r.URL.Path
 	log.Infof("Request received from address %s to service %s", r.RemoteAddr, service)
 	// After the next line being executed, the services map may change due to hot config changes
 	// This will lead to us serving a request to a service that may not be in the list or the belonging replicas have changed
 	// TODO (Mo-Fatah): Investigate this issue
-	balancer, err := m.findService(service)
+	svc, err := m.findService(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		common.WriteError(w, r, http.StatusNotFound)
 		log.Error(err)
 		return
 	}
 
-	server, err := balancer.Next()
+	// The service is found first since the priority of the request may be its own
+	class, priority := priorityOf(m.getConfig(), r, svc)
+	if !m.tryIncrementConnections(priority.Share) {
+		common.WriteError(w, r, http.StatusServiceUnavailable)
+		log.Errorf("Max connections reached, shedding request of priority %s", class)
+		return
+	}
+	defer m.decrementConnections()
+
+	if err := m.authenticateClient(r, svc); err != nil {
+		common.WriteError(w, r, http.StatusForbidden)
+		log.Errorf("Rejecting client %s of service %s: %s", r.RemoteAddr, service, err)
+		return
+	}
+
+	if svc.rateLimiter != nil {
+		decision := svc.rateLimiter.Allow(r, m.rateLimitStore)
+		decision.SetHeaders(w.Header())
+		if !decision.Allowed {
+			common.WriteError(w, r, http.StatusTooManyRequests)
+			log.Warnf("Rate limiting client %s of service %s", r.RemoteAddr, service)
+			return
+		}
+	}
+
+	m.retryBudget.Request()
+	if total := svc.config.Timeouts.Total; total > 0 && !isUpgrade(r) {
+		ctx, cancel := context.WithTimeout(r.Context(), total)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	server, release, err := svc.acquire(r.Context(), priority)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Errorf("All servers are down for service %s", service)
+		switch {
+		case errors.Is(err, limiter.ErrQueueFull), errors.Is(err, limiter.ErrQueueTimeout), errors.Is(err, limiter.ErrShed):
+			common.WriteError(w, r, http.StatusServiceUnavailable)
+			log.Warnf("Shedding request of priority %s to service %s: %s", class, service, err)
+		case r.Context().Err() != nil:
+			common.WriteProxyError(w, r, err)
+		default:
+			common.WriteError(w, r, http.StatusServiceUnavailable)
+			log.Errorf("All servers are down for service %s", service)
+		}
+		return
+	}
+	defer release()
+
+	if svc.retry != nil && !isUpgrade(r) {
+		m.proxyWithRetries(w, r, svc, server)
 		return
 	}
 
 	log.Infof("Proxying request to %s", server.GetUrl().String())
+	if isUpgrade(r) {
+		// The proxy keeps serving the request until the upgraded connection is closed,
+		// so it's counted against max_connections all along
+		w = &upgradeWriter{
+			ResponseWriter: w,
+			tracker:        m.upgrades,
+			replica:        server.GetUrl().String(),
+			idleTimeout:    m.getConfig().Upgrades.IdleTimeoutOrDefault(),
+		}
+	}
 	server.Proxy(w, r)
 }
 
-func (m *Mizan) findService(path string) (balancer.Balancer, error) {
-	if _, ok := m.serversMap[path]; !ok {
-		return nil, fmt.Errorf("couldn't find path %s", path)
+// findService finds the service whose matcher is the path of the request.
+// gRPC calls, whose paths are "/package.Service/Method", are routed by method
+// and fall back to the service matching "/package.Service".
+// Services that aren't exposed on the listener of the request aren't found.
+func (m *Mizan) findService(r *http.Request) (*service, error) {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	path := r.URL.Path
+	if svc, ok := m.services[path]; ok && m.exposes(r, svc) {
+		return svc, nil
+	}
+	if common.IsGRPC(r) {
+		if i := strings.LastIndex(path, "/"); i > 0 {
+			if svc, ok := m.services[path[:i]]; ok && m.exposes(r, svc) {
+				return svc, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("couldn't find path %s", path)
+}
+
+// exposes tells whether a service is exposed on the listener of a request, as set by the live config
+// so that reloads can change the services exposed. Must be called with mizanLock held.
+func (m *Mizan) exposes(r *http.Request, svc *service) bool {
+	listener, ok := listenerOf(r)
+	if !ok {
+		return true
+	}
+	for _, live := range m.config.AllListeners() {
+		if live.Name() == listener.Name() {
+			return live.Exposes(svc.config.Name)
+		}
 	}
-	return m.serversMap[path], nil
+	return listener.Exposes(svc.config.Name)
 }
 
+// ShutDown shuts Mizan down, returning false if it's already been shut down
 func (m *Mizan) ShutDown() bool {
+	shutDown := false
+	m.shutdownOnce.Do(func() {
+		m.shutDown()
+		shutDown = true
+	})
+	return shutDown
+}
+
+func (m *Mizan) shutDown() {
+	close(m.stopCh)
+	if m.adminServer != nil {
+		if err := m.adminServer.Shutdown(context.TODO()); err != nil {
+			log.Error(err)
+		}
+	}
+
 	// Send shutdown signal to all health checkers
-	for _, serviceBalancer := range m.serversMap {
-		serviceBalancer.HealthChecker().ShutDown()
+	for _, service := range m.services {
+		service.balancer.HealthChecker().ShutDown()
+	}
+	for _, service := range m.tcpServices {
+		service.balancer.HealthChecker().ShutDown()
+	}
+	for _, service := range m.udpServices {
+		service.balancer.HealthChecker().ShutDown()
 	}
 
 	// Send shutdown signal to all servers
-	for range m.ports {
+	for range m.listeners {
 		// Send shutdown signal
 		m.shutdownCh <- struct{}{}
 		// Wait for shutdown to complete
 		<-m.shutdownCh
 	}
+	// The servers don't wait for the connections they've upgraded, nor for the TCP ones
+	drained := &sync.WaitGroup{}
+	drained.Add(1)
+	go func() {
+		defer drained.Done()
+		m.upgrades.drain(func(string) bool { return true }, m.config.Upgrades.DrainTimeoutOrDefault())
+	}()
+	for _, service := range m.tcpServices {
+		drained.Add(1)
+		go func(service *tcpService) {
+			defer drained.Done()
+			replicas := make(map[string]bool)
+			for _, replica := range service.config.Replicas {
+				replicas[replica.Url] = true
+			}
+			m.tcpConns.drain(func(replica string) bool { return replicas[replica] }, service.config.DrainTimeoutOrDefault())
+		}(service)
+	}
+	drained.Wait()
 
 	log.Info("All servers are shutdown")
-	return true
 }
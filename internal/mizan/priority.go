@@ -0,0 +1,31 @@
+package mizan
+
+import (
+	"net/http"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/limiter"
+)
+
+// priorityOf returns the priority class of a request and its priority in the limiters. The class is the one given
+// by the priority header of the request if it's a known class and its client is trusted with it, or else the one of its
+// service, or else the default one.
+func priorityOf(conf *config.Config, r *http.Request, svc *service) (string, limiter.Priority) {
+	priority := &conf.Priority
+	class := svc.config.Priority
+	if header := priority.HeaderOrDefault(); header != "" {
+		if value := r.Header.Get(header); value != "" && priority.Trusts(r.RemoteAddr) {
+			if _, ok := priority.Level(value); ok {
+				class = value
+			}
+		}
+	}
+	level, ok := priority.Level(class)
+	if !ok {
+		// The service may be from another config than the one of the classes, if they were just reloaded
+		class = priority.DefaultOrDefault()
+		level, _ = priority.Level(class)
+	}
+	share := priority.ClassesOrDefault()[level].CapacityOrDefault() / 100
+	return class, limiter.Priority{Level: level, Share: share}
+}
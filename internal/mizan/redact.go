@@ -0,0 +1,60 @@
+package mizan
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	redactor        = &redactHook{secrets: make(map[string]struct{})}
+	installRedactor sync.Once
+)
+
+// redactHook is a logrus hook that redacts the secret values of the loaded configs from every log entry.
+// Secrets of previous configs are kept, since they may still show up in logs, e.g. when diffing configs on reload.
+type redactHook struct {
+	mu      sync.RWMutex
+	secrets map[string]struct{}
+}
+
+func (h *redactHook) add(conf *config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, secret := range conf.Secrets() {
+		h.secrets[secret] = struct{}{}
+	}
+}
+
+func (h *redactHook) redact(s string) string {
+	for secret := range h.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+func (h *redactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *redactHook) Fire(entry *log.Entry) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.secrets) == 0 {
+		return nil
+	}
+	entry.Message = h.redact(entry.Message)
+	for k, v := range entry.Data {
+		switch v := v.(type) {
+		case string:
+			entry.Data[k] = h.redact(v)
+		case error:
+			entry.Data[k] = h.redact(v.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package mizan
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/balancer"
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// proxyWithRetries proxies a request to the replicas of a service, starting with the given server, retrying it
+// on other replicas as far as the retry policy of the service and the retry budget allow
+func (m *Mizan) proxyWithRetries(w http.ResponseWriter, r *http.Request, svc *service, server *common.Server) {
+	policy := svc.retry
+	replay, replayable, err := policy.BufferBody(r)
+	if err != nil {
+		server.Skip()
+		common.WriteError(w, r, http.StatusBadRequest)
+		log.Errorf("Could not read the body of a request to service %s: %s", svc.config.Name, err)
+		return
+	}
+
+	tried := make(map[*common.Server]bool)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if server, err = nextUntried(svc.balancer, tried, len(svc.config.Replicas)); err != nil {
+				common.WriteError(w, r, http.StatusServiceUnavailable)
+				log.Errorf("All servers are down for service %s", svc.config.Name)
+				return
+			}
+		}
+		tried[server] = true
+		log.Infof("Proxying request to %s", server.GetUrl().String())
+
+		if replayable {
+			replay()
+		}
+		if !replayable || attempt == policy.Attempts() {
+			server.Proxy(w, r)
+			return
+		}
+		var proxyErr error
+		aw := &attemptWriter{
+			ResponseWriter: w,
+			header:         make(http.Header),
+			retries: func(status int) bool {
+				return policy.RetriesStatus(r, status) && m.retryBudget.TryRetry()
+			},
+		}
+		server.Proxy(aw, common.WithErrorSink(r, &proxyErr))
+		if proxyErr != nil {
+			if !policy.RetriesError(r, proxyErr) || !m.retryBudget.TryRetry() {
+				common.WriteProxyError(w, r, proxyErr)
+				return
+			}
+			log.Infof("Retrying request to service %s, which failed on %s: %s", svc.config.Name, server.GetUrl(), proxyErr)
+		} else if aw.dropped {
+			log.Infof("Retrying request to service %s, which %s answered with %d", svc.config.Name, server.GetUrl(), aw.status)
+		} else {
+			return
+		}
+
+		select {
+		case <-time.After(policy.Backoff(attempt + 1)):
+		case <-r.Context().Done():
+			common.WriteProxyError(w, r, r.Context().Err())
+			return
+		}
+	}
+}
+
+// nextUntried returns the next server of a balancer that hasn't been tried yet, or any alive server if they all have been.
+// It asks the balancer up to as many times as there are replicas, giving back every server it doesn't return.
+func nextUntried(b balancer.Balancer, tried map[*common.Server]bool, replicas int) (*common.Server, error) {
+	server, err := b.Next()
+	for i := 1; err == nil && tried[server] && i < replicas; i++ {
+		next, err := b.Next()
+		server.Skip()
+		if err != nil {
+			return nil, err
+		}
+		server = next
+	}
+	return server, err
+}
+
+// attemptWriter holds the response of an attempt back until its status is known,
+// and drops it if the request is retried because of its status
+type attemptWriter struct {
+	http.ResponseWriter
+	// header collects the headers of the response until it's committed
+	header http.Header
+	// retries tells whether a response with the given status is retried
+	retries   func(status int) bool
+	status    int
+	committed bool
+	dropped   bool
+}
+
+func (w *attemptWriter) Header() http.Header {
+	if w.committed {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *attemptWriter) WriteHeader(status int) {
+	if w.committed || w.dropped {
+		return
+	}
+	w.status = status
+	// Informational responses are left to net/http, which answers Expect: 100-continue on its own
+	if status < http.StatusOK {
+		return
+	}
+	if w.retries(status) {
+		w.dropped = true
+		return
+	}
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	w.committed = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *attemptWriter) Write(b []byte) (int, error) {
+	if !w.committed && !w.dropped {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.dropped {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *attemptWriter) Flush() {
+	if !w.committed {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *attemptWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,120 @@
+package mizan
+
+import (
+	"crypto/tls"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/balancer"
+	"github.com/Mo-Fatah/mizan/internal/pkg/breaker"
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/health"
+	"github.com/Mo-Fatah/mizan/internal/pkg/limiter"
+	"github.com/Mo-Fatah/mizan/internal/pkg/ratelimit"
+	"github.com/Mo-Fatah/mizan/internal/pkg/retry"
+	"github.com/Mo-Fatah/mizan/internal/pkg/tlsconfig"
+)
+
+// service is a configured service along with what's needed to serve it
+type service struct {
+	config   *config.Service
+	balancer balancer.Balancer
+	// servers are the servers of the replicas, as balanced by the balancer
+	servers []*common.Server
+	// clientAuth verifies the client certificates of each request, nil if the service doesn't authenticate clients
+	clientAuth *tlsconfig.ClientVerifier
+	// retry is the retry policy of the service, nil if its requests aren't retried
+	retry *retry.Policy
+	// rateLimiter applies the rate limits of the service, nil if it has none
+	rateLimiter *ratelimit.Limiter
+	// limiter limits the requests in flight to the service and queues the others, nil if they aren't limited
+	limiter *limiter.Limiter
+	// adaptive adjusts the limit of the limiter to the latency of the replicas, nil if it's static
+	adaptive *limiter.Adaptive
+}
+
+// buildServices builds the services keyed by their matcher. The concurrency limiter of a current service is
+// carried over by the service replacing it if their concurrency is the same, so that a reload keeps the requests
+// in flight and queued, and the limit an adaptive limiter has found. Likewise the circuit breakers of its replicas
+// are carried over if their circuit breaker config is the same, so that a reload doesn't close the open breakers.
+func buildServices(conf *config.Config, current map[string]*service) (map[string]*service, error) {
+	services := make(map[string]*service)
+	for i := range conf.Services {
+		serviceConf := &conf.Services[i]
+		var upstreamTLS *tls.Config
+		if serviceConf.UpstreamTLS != nil {
+			var err error
+			if upstreamTLS, err = tlsconfig.NewClientConfig(serviceConf.UpstreamTLS); err != nil {
+				return nil, fmt.Errorf("upstream_tls of service %s: %w", serviceConf.Name, err)
+			}
+		}
+		old := current[serviceConf.Matcher]
+		breakers := make(map[string]*breaker.Breaker)
+		if old != nil && serviceConf.CircuitBreaker != nil && reflect.DeepEqual(old.config.CircuitBreaker, serviceConf.CircuitBreaker) {
+			for _, server := range old.servers {
+				breakers[server.GetUrl().String()] = server.GetBreaker()
+			}
+		}
+		servers := make([]*common.Server, 0)
+		for _, replica := range serviceConf.Replicas {
+			server := common.NewServer(replica, serviceConf, upstreamTLS)
+			if b, ok := breakers[server.GetUrl().String()]; ok {
+				server.SetBreaker(b)
+			}
+			servers = append(servers, server)
+		}
+		svc := &service{
+			config:   serviceConf,
+			balancer: newBalancer(servers, conf.Strategy),
+			servers:  servers,
+		}
+		svc.balancer.SetHealthChecker(health.NewHealthChecker(servers, serviceConf.Name))
+
+		if serviceConf.ClientAuth != nil {
+			verifier, err := tlsconfig.NewClientVerifier(serviceConf.ClientAuth)
+			if err != nil {
+				return nil, fmt.Errorf("client_auth of service %s: %w", serviceConf.Name, err)
+			}
+			svc.clientAuth = verifier
+		}
+		if serviceConf.Retries != nil {
+			svc.retry = retry.NewPolicy(serviceConf.Retries)
+		}
+		if concurrency := serviceConf.Concurrency; concurrency != nil {
+			if old != nil && old.limiter != nil && reflect.DeepEqual(old.config.Concurrency, concurrency) {
+				svc.limiter, svc.adaptive = old.limiter, old.adaptive
+			} else {
+				svc.limiter = limiter.NewLimiter(concurrency.MaxInFlight, concurrency.Queue.Size, concurrency.Queue.TimeoutOrDefault())
+				if concurrency.Adaptive != nil {
+					// The limit is adjusted to the latency of the replicas
+					svc.adaptive = limiter.NewAdaptive(serviceConf.Name, svc.limiter, concurrency.Adaptive)
+				}
+			}
+			for _, server := range servers {
+				// The requests waiting for a replica with room are woken up as soon as one has room
+				server.SetOnRelease(svc.limiter.Notify)
+				if svc.adaptive != nil {
+					server.SetObserver(svc.adaptive.Observe)
+				}
+			}
+		}
+		if len(serviceConf.RateLimits) > 0 {
+			svc.rateLimiter = ratelimit.NewLimiter(serviceConf.Name, serviceConf.RateLimits)
+		}
+		services[serviceConf.Matcher] = svc
+	}
+	return services, nil
+}
+
+func newBalancer(servers []*common.Server, strategy string) balancer.Balancer {
+	switch strings.ToLower(strategy) {
+	case "rr":
+		return balancer.NewRR(servers)
+	case "wrr":
+		return balancer.NewWRR(servers)
+	default:
+		return balancer.NewRR(servers)
+	}
+}
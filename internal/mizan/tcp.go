@@ -0,0 +1,172 @@
+package mizan
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/balancer"
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/health"
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	"github.com/Mo-Fatah/mizan/internal/pkg/proxyproto"
+	log "github.com/sirupsen/logrus"
+)
+
+// tcpService is a configured TCP service along with what's needed to serve it
+type tcpService struct {
+	config   *config.TCPService
+	balancer balancer.Balancer
+}
+
+// buildTCPServices builds the TCP services keyed by their port
+func buildTCPServices(conf *config.Config) map[int]*tcpService {
+	services := make(map[int]*tcpService)
+	for i := range conf.TCP {
+		serviceConf := &conf.TCP[i]
+		servers := make([]*common.Server, 0)
+		for _, replica := range serviceConf.Replicas {
+			servers = append(servers, common.NewL4Server(replica, serviceConf.Name))
+		}
+		svc := &tcpService{
+			config:   serviceConf,
+			balancer: newBalancer(servers, conf.Strategy),
+		}
+		svc.balancer.SetHealthChecker(health.NewHealthChecker(servers, serviceConf.Name))
+		services[serviceConf.Port] = svc
+	}
+	return services
+}
+
+// startTCPServer serves the TCP service of a port on the address it's bound to, which like the port is only read on startup
+func (m *Mizan) startTCPServer(port int, address string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	log.Info("Starting tcp server on ", address)
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	go func() {
+		<-m.stopCh
+		ln.Close()
+	}()
+	// Like the port, the PROXY protocol accepted on it is only read on startup
+	if svc := m.findTCPService(port); svc != nil && svc.config.ProxyProtocol != nil {
+		ln = proxyproto.NewListener(ln, svc.config.ProxyProtocol.TrustedNets(), svc.config.ProxyProtocol.HeaderTimeoutOrDefault())
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-m.stopCh:
+				log.Info("Shutting down tcp server on port ", port)
+				return
+			default:
+			}
+			log.Error(err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go m.serveTCP(conn, port)
+	}
+}
+
+// serveTCP proxies a connection accepted on a port to a replica of the TCP service of the port
+func (m *Mizan) serveTCP(conn net.Conn, port int) {
+	if !m.tryIncrementConnections(1) {
+		conn.Close()
+		log.Error("Max connections reached")
+		return
+	}
+	defer m.decrementConnections()
+
+	if proxied, ok := conn.(*proxyproto.Conn); ok {
+		if err := proxied.Handshake(); err != nil {
+			return
+		}
+	}
+	svc := m.findTCPService(port)
+	if svc == nil {
+		conn.Close()
+		log.Errorf("No tcp service on port %d", port)
+		return
+	}
+	log.Infof("Connection received from address %s to tcp service %s", conn.RemoteAddr(), svc.config.Name)
+
+	server, err := svc.balancer.Next()
+	if err != nil {
+		conn.Close()
+		log.Errorf("All servers are down for tcp service %s", svc.config.Name)
+		return
+	}
+	replica := server.GetUrl().String()
+	backend, err := net.DialTimeout(server.GetNetwork(), server.GetAddress(), svc.config.ConnectTimeoutOrDefault())
+	if err != nil {
+		conn.Close()
+		log.Errorf("Could not connect to server %s of tcp service %s: %s", replica, svc.config.Name, err)
+		return
+	}
+	if svc.config.SendProxyProtocol != "" {
+		if err := sendProxyHeader(backend, conn, svc.config.SendProxyProtocol); err != nil {
+			conn.Close()
+			backend.Close()
+			log.Errorf("Could not send the PROXY protocol header to server %s of tcp service %s: %s", replica, svc.config.Name, err)
+			return
+		}
+	}
+
+	l4.Splice(m.tcpConns.track(conn, replica, svc.config.IdleTimeoutOrDefault()), backend, m.l4CountersOf(replica))
+}
+
+// sendProxyHeader sends the addresses of a client connection to a replica in a PROXY protocol header of the given version
+func sendProxyHeader(backend, client net.Conn, version string) error {
+	header := &proxyproto.Header{}
+	header.Source, _ = client.RemoteAddr().(*net.TCPAddr)
+	header.Destination, _ = client.LocalAddr().(*net.TCPAddr)
+	formatted, err := header.Format(map[string]int{config.ProxyProtocolV1: 1, config.ProxyProtocolV2: 2}[version])
+	if err != nil {
+		return err
+	}
+	_, err = backend.Write(formatted)
+	return err
+}
+
+func (m *Mizan) findTCPService(port int) *tcpService {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	return m.tcpServices[port]
+}
+
+// l4CountersOf returns the counters of the TCP connections or UDP sessions of a replica, which are kept across reloads
+func (m *Mizan) l4CountersOf(replica string) *l4.Counters {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	counters, ok := m.l4Counters[replica]
+	if !ok {
+		counters = &l4.Counters{}
+		m.l4Counters[replica] = counters
+	}
+	return counters
+}
+
+// drainTCPServices drains the connections to the replicas of the old TCP services that aren't in the new ones
+func drainTCPServices(tracker *connTracker, oldServices, newServices map[int]*tcpService) {
+	for port, oldService := range oldServices {
+		kept := make(map[string]bool)
+		if newService, ok := newServices[port]; ok {
+			for _, replica := range newService.config.Replicas {
+				kept[replica.Url] = true
+			}
+		}
+		removed := make(map[string]bool)
+		for _, replica := range oldService.config.Replicas {
+			if !kept[replica.Url] {
+				removed[replica.Url] = true
+			}
+		}
+		go tracker.drain(func(replica string) bool { return removed[replica] }, oldService.config.DrainTimeoutOrDefault())
+	}
+}
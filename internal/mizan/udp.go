@@ -0,0 +1,97 @@
+package mizan
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/balancer"
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/Mo-Fatah/mizan/internal/pkg/health"
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	log "github.com/sirupsen/logrus"
+)
+
+// udpService is a configured UDP service along with what's needed to serve it
+type udpService struct {
+	config *config.UDPService
+	// The replica of a session is picked by hashing the IP of the client
+	balancer *balancer.Hash
+}
+
+// buildUDPServices builds the UDP services keyed by their port
+func buildUDPServices(conf *config.Config) map[int]*udpService {
+	services := make(map[int]*udpService)
+	for i := range conf.UDP {
+		serviceConf := &conf.UDP[i]
+		servers := make([]*common.Server, 0)
+		for _, replica := range serviceConf.Replicas {
+			servers = append(servers, common.NewL4Server(replica, serviceConf.Name))
+		}
+		svc := &udpService{
+			config:   serviceConf,
+			balancer: balancer.NewHash(servers),
+		}
+		svc.balancer.SetHealthChecker(health.NewHealthChecker(servers, serviceConf.Name))
+		services[serviceConf.Port] = svc
+	}
+	return services
+}
+
+// startUDPServer serves the UDP service of a port on the address it's bound to, which like the port is only read on startup
+func (m *Mizan) startUDPServer(port int, address string, wg *sync.WaitGroup) {
+	defer wg.Done()
+	log.Info("Starting udp server on ", address)
+	udpAddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	go func() {
+		<-m.stopCh
+		conn.Close()
+	}()
+
+	pick := func(client *net.UDPAddr) (*l4.Upstream, error) {
+		svc := m.findUDPService(port)
+		if svc == nil {
+			return nil, fmt.Errorf("no udp service on port %d", port)
+		}
+		server, err := svc.balancer.NextFor(client.IP.String())
+		if err != nil {
+			return nil, fmt.Errorf("all servers are down for udp service %s", svc.config.Name)
+		}
+		replica := server.GetUrl().String()
+		log.Debugf("Session of %s to udp service %s assigned to %s", client, svc.config.Name, replica)
+		return &l4.Upstream{Name: replica, Address: server.GetAddress(), Counters: m.l4CountersOf(replica)}, nil
+	}
+	sessionTimeout := func() time.Duration {
+		if svc := m.findUDPService(port); svc != nil {
+			return svc.config.SessionTimeoutOrDefault()
+		}
+		return 0
+	}
+	maxSessions := func() int {
+		if svc := m.findUDPService(port); svc != nil {
+			return svc.config.MaxSessionsOrDefault()
+		}
+		return 0
+	}
+	if err := l4.NewUDPProxy(conn, pick, sessionTimeout, maxSessions).Serve(); err != nil {
+		log.Error(err)
+	}
+	log.Info("Shutting down udp server on port ", port)
+}
+
+func (m *Mizan) findUDPService(port int) *udpService {
+	m.mizanLock.Lock()
+	defer m.mizanLock.Unlock()
+	return m.udpServices[port]
+}
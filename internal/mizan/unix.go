@@ -0,0 +1,104 @@
+package mizan
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// listen listens on the address or the Unix domain socket of a listener
+func listen(listener config.Listener) (net.Listener, error) {
+	if listener.Socket == nil {
+		return net.Listen(listener.NetworkOrDefault(), listener.ListenAddress())
+	}
+	return listenUnix(listener.Socket)
+}
+
+// listenUnix listens on a Unix domain socket, replacing the socket left behind by a previous run if there's one.
+// The socket is created in a private directory and only moved into place once its mode and owner are set,
+// so that it's never reachable with wider permissions. The socket file is removed when the listener is closed.
+func listenUnix(socket *config.UnixSocket) (net.Listener, error) {
+	if info, err := os.Lstat(socket.Path); err == nil && info.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("%s exists and isn't a socket", socket.Path)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(socket.Path), ".mizan")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: private, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed from where it's moved to rather than from the private directory
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, socket.ModeOrDefault()); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if socket.Owner != "" || socket.Group != "" {
+		uid, gid, err := lookupOwner(socket.Owner, socket.Group)
+		if err == nil {
+			err = os.Chown(private, uid, gid)
+		}
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("could not set the owner of %s: %w", socket.Path, err)
+		}
+	}
+	// Replaces the socket of a previous run at once
+	if err := os.Rename(private, socket.Path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: ln, path: socket.Path}, nil
+}
+
+// unixListener is a listener on a Unix domain socket moved to path, which is removed once the listener is closed
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	if err := l.UnixListener.Close(); err != nil {
+		return err
+	}
+	os.Remove(l.path)
+	return nil
+}
+
+// lookupOwner returns the ids of a user and a group given by name or id, -1 for the ones that aren't given
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return 0, 0, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
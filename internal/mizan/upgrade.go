@@ -0,0 +1,46 @@
+package mizan
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && httpguts.HeaderValuesContainsToken(r.Header["Connection"], "Upgrade")
+}
+
+// upgradeWriter hands out the connections it's hijacked from to a tracker
+type upgradeWriter struct {
+	http.ResponseWriter
+	tracker     *connTracker
+	replica     string
+	idleTimeout time.Duration
+}
+
+func (w *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		// HTTP/2 connections are multiplexed and can't be upgraded
+		return nil, nil, errors.New("the connection can't be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.tracker.track(conn, w.replica, w.idleTimeout), rw, nil
+}
+
+func (w *upgradeWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *upgradeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
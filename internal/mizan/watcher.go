@@ -0,0 +1,154 @@
+package mizan
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// A single save usually produces a burst of events (truncate, write, chmod, rename...).
+	// Events are coalesced into one reload once no new event arrived for this long.
+	reloadDebounce = 250 * time.Millisecond
+)
+
+// Reload asks Mizan to reload its config file. Reloads are applied one at a time,
+// and a reload requested while another one is pending is coalesced with it.
+func (m *Mizan) Reload() {
+	select {
+	case m.reloadCh <- struct{}{}:
+	default:
+	}
+}
+
+// cfgReloader applies the reloads requested through the reload channel
+func (m *Mizan) cfgReloader() {
+	for {
+		select {
+		case <-m.reloadCh:
+			log.Info("Reloading config")
+			m.cfgController()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// cfgWatcher watches the config file and the files it includes, and requests a reload when any of them changes.
+// Parent directories are watched rather than the files themselves, since editors and Kubernetes ConfigMaps
+// replace files through a rename or a symlink swap, after which a watch on the old file never fires again.
+// Watching directories also picks up new files matching the include patterns.
+func (m *Mizan) cfgWatcher() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+
+	configPath, err := filepath.Abs(m.configPath)
+	if err != nil {
+		log.Errorf("Error while watching config file: %s", err)
+		return
+	}
+
+	watchedDirs := make(map[string]bool)
+	// The files of the live config, mapped to the real files behind them.
+	// A real file changes when a symlink in its path is swapped.
+	var sources map[string]string
+	var patterns []string
+	// refresh updates what is being watched from the live config, since its includes may have changed
+	refresh := func() {
+		m.mizanLock.Lock()
+		conf := m.config
+		m.mizanLock.Unlock()
+
+		sources = map[string]string{configPath: ""}
+		for _, source := range conf.Sources() {
+			sources[source] = ""
+		}
+		for source := range sources {
+			sources[source], _ = filepath.EvalSymlinks(source)
+		}
+		patterns = conf.IncludePatterns()
+
+		dirs := make([]string, 0, len(sources)+len(patterns))
+		for source := range sources {
+			dirs = append(dirs, filepath.Dir(source))
+		}
+		for _, pattern := range patterns {
+			// Directories that are globs themselves can't be watched
+			if dir := filepath.Dir(pattern); !strings.ContainsAny(dir, `*?[\`) {
+				dirs = append(dirs, dir)
+			}
+		}
+		for _, dir := range dirs {
+			if watchedDirs[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				log.Errorf("Error while watching config directory %s: %s", dir, err)
+				continue
+			}
+			watchedDirs[dir] = true
+		}
+	}
+	// relevant tells whether an event may have changed the config
+	relevant := func(event fsnotify.Event) bool {
+		name := filepath.Clean(event.Name)
+		swapped := false
+		for source, realPath := range sources {
+			newRealPath, _ := filepath.EvalSymlinks(source)
+			if newRealPath != realPath {
+				swapped = true
+			}
+			sources[source] = newRealPath
+		}
+		if _, ok := sources[name]; ok || swapped {
+			return true
+		}
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+	refresh()
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !relevant(event) {
+				continue
+			}
+			if event.Has(fsnotify.Remove) && sources[configPath] == "" {
+				// The file may be recreated, a reload will be triggered when it is
+				log.Warn("The config file has been removed, waiting for it to be recreated")
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case <-debounce.C:
+			log.Info("Config file has been modified")
+			m.Reload()
+		case <-m.appliedCh:
+			refresh()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Error while watching config file: %s", err)
+		case <-m.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServers creates alive servers with the given weights
+func newServers(weights ...int) []*common.Server {
+	servers := make([]*common.Server, 0)
+	for i, weight := range weights {
+		replica := &config.Replica{
+			Url:      fmt.Sprintf("http://10.0.0.%d:8080", i),
+			MetaData: map[string]string{"weight": fmt.Sprint(weight)},
+		}
+		server := common.NewL4Server(replica, "api")
+		server.SetLiveness(true)
+		servers = append(servers, server)
+	}
+	return servers
+}
+
+// picks returns the urls of the next n servers picked by a balancer
+func picks(t *testing.T, b Balancer, n int) []string {
+	t.Helper()
+	urls := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		server, err := b.Next()
+		require.NoError(t, err)
+		urls = append(urls, server.GetUrl().Host)
+	}
+	return urls
+}
+
+func TestRR_Next(t *testing.T) {
+	servers := newServers(1, 1, 1)
+	rr := NewRR(servers)
+	assert.Equal(t, []string{"10.0.0.0:8080", "10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.0:8080"}, picks(t, rr, 4))
+
+	servers[1].SetLiveness(false)
+	assert.Equal(t, []string{"10.0.0.2:8080", "10.0.0.0:8080", "10.0.0.2:8080"}, picks(t, rr, 3))
+}
+
+func TestWRR_Next(t *testing.T) {
+	servers := newServers(2, 1)
+	wrr := NewWRR(servers)
+	assert.Equal(t, []string{"10.0.0.0:8080", "10.0.0.0:8080", "10.0.0.1:8080", "10.0.0.0:8080"}, picks(t, wrr, 4))
+
+	servers[0].SetLiveness(false)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.1:8080"}, picks(t, wrr, 2))
+}
+
+// A pool without alive servers fails right away rather than waiting for a server to come back
+func TestNext_NoAliveServers(t *testing.T) {
+	servers := newServers(2, 1)
+	for _, server := range servers {
+		server.SetLiveness(false)
+	}
+	for name, b := range map[string]Balancer{"rr": NewRR(servers), "wrr": NewWRR(servers)} {
+		start := time.Now()
+		_, err := b.Next()
+		assert.ErrorIs(t, err, ErrNoAliveServers, name)
+		assert.Less(t, time.Since(start), 100*time.Millisecond, name)
+	}
+}
@@ -0,0 +1,92 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/health"
+)
+
+// Hash Balancer picks the server of a key by weighted rendezvous hashing.
+// A key keeps going to the same server as long as it's alive, and when a server goes down
+// only its keys are moved to the other servers.
+type Hash struct {
+	servers []*common.Server
+	// Mutex to protect the Servers slice from concurrent writes (when adding new servers with hot reload)
+	mu *sync.Mutex
+
+	Hc *health.HealthChecker
+}
+
+func NewHash(servers []*common.Server) *Hash {
+	return &Hash{
+		servers: servers,
+		mu:      &sync.Mutex{},
+	}
+}
+
+// Next returns the server of the empty key, callers having a key should use NextFor
+func (h *Hash) Next() (*common.Server, error) {
+	return h.NextFor("")
+}
+
+// NextFor returns the alive server with the highest score for the key whose circuit breaker lets the request through
+func (h *Hash) NextFor(key string) (*common.Server, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	candidates := make([]*common.Server, 0, len(h.servers))
+	scores := make(map[*common.Server]float64, len(h.servers))
+	for _, server := range h.servers {
+		if server.IsAlive() {
+			candidates = append(candidates, server)
+			scores[server] = score(key, server)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return scores[candidates[i]] > scores[candidates[j]]
+	})
+	// Breakers are asked in order of score, since asking a half-open one lets a probe through
+	for _, server := range candidates {
+		if server.Allow() {
+			return server, nil
+		}
+	}
+	return nil, ErrNoAliveServers
+}
+
+// score is the weighted rendezvous hashing score of a server for a key
+func score(key string, server *common.Server) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	hash.Write([]byte(server.GetUrl().String()))
+	// A uniform value in (0, 1), FNV is mixed since its high bits vary little between close inputs
+	uniform := (float64(mix(hash.Sum64())>>11) + 0.5) / (1 << 53)
+	return float64(server.GetWeight()) / -math.Log(uniform)
+}
+
+// mix is the finalizer of SplitMix64
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *Hash) Add(s *common.Server) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.servers = append(h.servers, s)
+}
+
+func (h *Hash) HealthChecker() *health.HealthChecker {
+	return h.Hc
+}
+
+func (h *Hash) SetHealthChecker(hc *health.HealthChecker) {
+	h.Hc = hc
+}
@@ -0,0 +1,53 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash_NextFor(t *testing.T) {
+	servers := make([]*common.Server, 0)
+	for i := 0; i < 3; i++ {
+		server := common.NewL4Server(&config.Replica{Url: fmt.Sprintf("udp://10.0.0.%d:53", i)}, "dns")
+		server.SetLiveness(true)
+		servers = append(servers, server)
+	}
+	hash := NewHash(servers)
+
+	picked := make(map[string]*common.Server)
+	counts := make(map[*common.Server]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("192.168.1.%d:5353", i)
+		server, err := hash.NextFor(key)
+		require.NoError(t, err)
+		picked[key] = server
+		counts[server]++
+	}
+	// Keys are spread across the servers
+	for _, server := range servers {
+		assert.Greater(t, counts[server], 50)
+	}
+
+	// Only the keys of a server that goes down are moved
+	servers[0].SetLiveness(false)
+	for key, server := range picked {
+		next, err := hash.NextFor(key)
+		require.NoError(t, err)
+		if server != servers[0] {
+			assert.Same(t, server, next)
+		} else {
+			assert.NotSame(t, servers[0], next)
+		}
+	}
+
+	for _, server := range servers {
+		server.SetLiveness(false)
+	}
+	_, err := hash.NextFor("192.168.1.1:5353")
+	assert.ErrorIs(t, err, ErrNoAliveServers)
+}
@@ -2,7 +2,6 @@ package balancer
 
 import (
 	"sync"
-	"time"
 
 	"github.com/Mo-Fatah/mizan/internal/pkg/common"
 	"github.com/Mo-Fatah/mizan/internal/pkg/health"
@@ -31,17 +30,15 @@ func NewRR(servers []*common.Server) *RR {
 func (rr *RR) Next() (*common.Server, error) {
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
-	start := time.Now()
-	for {
+	// A single pass over the servers, the request fails right away if none is alive with its circuit breaker letting it through
+	for i := 0; i < len(rr.servers); i++ {
 		curr := rr.current
 		rr.current = (rr.current + 1) % uint32(len(rr.servers))
-		if rr.servers[curr].IsAlive() {
+		if rr.servers[curr].Allow() {
 			return rr.servers[curr], nil
 		}
-		if time.Since(start) > timeout {
-			return nil, ErrNoAliveServers
-		}
 	}
+	return nil, ErrNoAliveServers
 }
 
 func (rr *RR) Add(s *common.Server) {
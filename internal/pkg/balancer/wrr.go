@@ -2,7 +2,6 @@ package balancer
 
 import (
 	"sync"
-	"time"
 
 	"github.com/Mo-Fatah/mizan/internal/pkg/common"
 	"github.com/Mo-Fatah/mizan/internal/pkg/health"
@@ -38,27 +37,21 @@ func (wrr *WRR) Next() (*common.Server, error) {
 	wrr.mu.Lock()
 	defer wrr.mu.Unlock()
 
-	var server *common.Server
-	start := time.Now()
-	for {
-		if wrr.currentServerLoadCounter < wrr.servers[wrr.current].GetWeight() {
+	if len(wrr.servers) == 0 {
+		return nil, ErrNoAliveServers
+	}
+	// A single pass over the servers, back to the current one, the request fails right away if none is alive
+	// with its circuit breaker letting it through
+	for i := 0; i <= len(wrr.servers); i++ {
+		server := wrr.servers[wrr.current]
+		if wrr.currentServerLoadCounter < server.GetWeight() && server.Allow() {
 			wrr.currentServerLoadCounter++
-			server = wrr.servers[wrr.current]
-		} else {
-			wrr.currentServerLoadCounter = 1
-			wrr.current = (wrr.current + 1) % uint32(len(wrr.servers))
-			server = wrr.servers[wrr.current]
-		}
-
-		if server.IsAlive() {
-			break
-		}
-
-		if time.Since(start) > timeout {
-			return nil, ErrNoAliveServers
+			return server, nil
 		}
+		wrr.currentServerLoadCounter = 0
+		wrr.current = (wrr.current + 1) % uint32(len(wrr.servers))
 	}
-	return server, nil
+	return nil, ErrNoAliveServers
 }
 
 func (rr *WRR) HealthChecker() *health.HealthChecker {
@@ -0,0 +1,230 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// The window is split in buckets sliding one at a time
+const windowBuckets = 10
+
+type State int
+
+const (
+	// Closed lets all requests through
+	Closed State = iota
+	// Open lets no request through until the open timeout elapses
+	Open
+	// HalfOpen lets one probe through at a time, closing again after enough successful probes
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Result is the outcome of a request let through by a breaker
+type Result int
+
+const (
+	Success Result = iota
+	Failure
+	// Ignored is a request that tells nothing about the replica, e.g. canceled by the client
+	Ignored
+)
+
+// Breaker is the circuit breaker of a replica, opened by its error rate or consecutive failures over a sliding window
+type Breaker struct {
+	mu *sync.Mutex
+	// name identifies the replica of the breaker in the logs
+	name     string
+	settings config.CircuitBreaker
+
+	state State
+	// buckets count the requests and failures of each slice of the window, by slice number modulo the window
+	buckets     [windowBuckets]bucket
+	consecutive int
+	openedAt    time.Time
+	// probeStarted is when the probe of a half-open breaker was let through, zero when none is in flight
+	probeStarted time.Time
+	successes    int
+	trips        int64
+	now          func() time.Time
+}
+
+type bucket struct {
+	slice    int64
+	requests int64
+	failures int64
+}
+
+// Snapshot describes a breaker in the admin API
+type Snapshot struct {
+	State               State      `json:"state"`
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Trips               int64      `json:"trips"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+func NewBreaker(name string, settings *config.CircuitBreaker) *Breaker {
+	return &Breaker{
+		mu:       &sync.Mutex{},
+		name:     name,
+		settings: *settings,
+		now:      time.Now,
+	}
+}
+
+// Allow tells whether a request can be sent to the replica, an allowed request must be reported with Done
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	openTimeout := b.settings.OpenTimeoutOrDefault()
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < openTimeout {
+			return false
+		}
+		b.state = HalfOpen
+		b.successes = 0
+	case HalfOpen:
+		// A probe never reported, e.g. dropped by a retry, doesn't hold the breaker forever
+		if !b.probeStarted.IsZero() && now.Sub(b.probeStarted) < openTimeout {
+			return false
+		}
+	default:
+		return true
+	}
+	b.probeStarted = now
+	return true
+}
+
+// Done reports the result of a request let through by Allow
+func (b *Breaker) Done(result Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if result == Ignored {
+		if b.state == HalfOpen {
+			b.probeStarted = time.Time{}
+		}
+		return
+	}
+
+	counts := b.current()
+	counts.requests++
+	if result == Failure {
+		counts.failures++
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	switch b.state {
+	case HalfOpen:
+		b.probeStarted = time.Time{}
+		if result == Failure {
+			b.open()
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenSuccessesOrDefault() {
+			b.state = Closed
+			b.buckets = [windowBuckets]bucket{}
+			log.Infof("Circuit breaker of %s closed", b.name)
+		}
+	case Closed:
+		if result == Failure && b.tripped() {
+			b.open()
+		}
+	}
+}
+
+// State returns the state of the breaker, an open one only turning half-open when a request is allowed after its timeout
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	requests, failures := b.counts()
+	snapshot := Snapshot{
+		State:               b.state,
+		Requests:            requests,
+		Failures:            failures,
+		ConsecutiveFailures: b.consecutive,
+		Trips:               b.trips,
+	}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	return snapshot
+}
+
+func (b *Breaker) tripped() bool {
+	if b.consecutive >= b.settings.ConsecutiveFailuresOrDefault() {
+		return true
+	}
+	requests, failures := b.counts()
+	if requests < int64(b.settings.MinRequestsOrDefault()) {
+		return false
+	}
+	return float64(failures)*100 >= float64(requests)*b.settings.ErrorRateOrDefault()
+}
+
+func (b *Breaker) open() {
+	b.state = Open
+	b.openedAt = b.now()
+	b.trips++
+	log.Warnf("Circuit breaker of %s opened for %s", b.name, b.settings.OpenTimeoutOrDefault())
+}
+
+// counts returns the requests and failures of the window
+func (b *Breaker) counts() (requests, failures int64) {
+	slice := b.slice()
+	for _, counts := range b.buckets {
+		if slice-counts.slice < windowBuckets {
+			requests += counts.requests
+			failures += counts.failures
+		}
+	}
+	return requests, failures
+}
+
+// current returns the bucket of the current slice, emptied if it's been left from a previous window
+func (b *Breaker) current() *bucket {
+	slice := b.slice()
+	counts := &b.buckets[slice%windowBuckets]
+	if counts.slice != slice {
+		*counts = bucket{slice: slice}
+	}
+	return counts
+}
+
+func (b *Breaker) slice() int64 {
+	width := b.settings.WindowOrDefault() / windowBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return b.now().UnixNano() / int64(width)
+}
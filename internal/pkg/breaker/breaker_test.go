@@ -0,0 +1,88 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBreaker returns a breaker whose clock is moved by advancing the returned time
+func newTestBreaker(settings config.CircuitBreaker) (*Breaker, *time.Time) {
+	now := time.Unix(1000, 0)
+	b := NewBreaker("test", &settings)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker_ConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(config.CircuitBreaker{ConsecutiveFailures: 3})
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.Done(Failure)
+	}
+	b.Done(Success)
+	assert.Equal(t, Closed, b.State(), "a success resets the consecutive failures")
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, b.Allow())
+		b.Done(Failure)
+	}
+	assert.Equal(t, Open, b.State())
+	assert.False(t, b.Allow())
+	assert.Equal(t, int64(1), b.Snapshot().Trips)
+}
+
+func TestBreaker_ErrorRate(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreaker{Window: 10 * time.Second, MinRequests: 10, ErrorRate: 50, ConsecutiveFailures: 100})
+	for i := 0; i < 4; i++ {
+		b.Done(Success)
+		b.Done(Failure)
+	}
+	assert.Equal(t, Closed, b.State(), "too few requests to consider the error rate")
+
+	// The requests leave the window as it slides
+	*now = now.Add(11 * time.Second)
+	b.Done(Success)
+	b.Done(Failure)
+	assert.Equal(t, int64(2), b.Snapshot().Requests)
+
+	for i := 0; i < 4; i++ {
+		b.Done(Success)
+		b.Done(Failure)
+	}
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreaker{ConsecutiveFailures: 1, OpenTimeout: time.Second, HalfOpenSuccesses: 2})
+	b.Done(Failure)
+	assert.False(t, b.Allow())
+
+	*now = now.Add(time.Second)
+	assert.True(t, b.Allow())
+	assert.Equal(t, HalfOpen, b.State())
+	assert.False(t, b.Allow(), "one probe at a time")
+	b.Done(Failure)
+	assert.Equal(t, Open, b.State(), "a failed probe opens the breaker again")
+
+	*now = now.Add(time.Second)
+	assert.True(t, b.Allow())
+	b.Done(Ignored)
+	assert.True(t, b.Allow(), "an ignored probe lets another one through")
+	b.Done(Success)
+	assert.Equal(t, HalfOpen, b.State())
+	assert.True(t, b.Allow())
+	b.Done(Success)
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, int64(2), b.Snapshot().Trips)
+
+	// A probe never reported is forgotten after the open timeout
+	b.Done(Failure)
+	*now = now.Add(time.Second)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	*now = now.Add(time.Second)
+	assert.True(t, b.Allow())
+}
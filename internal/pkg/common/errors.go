@@ -0,0 +1,74 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	GRPCUnknown          = 2
+	GRPCPermissionDenied = 7
+	GRPCUnimplemented    = 12
+	GRPCInternal         = 13
+	GRPCUnavailable      = 14
+	GRPCUnauthenticated  = 16
+)
+
+// IsGRPC tells whether a request is a gRPC call
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// IsTimeout tells whether proxying a request failed because it timed out, connecting to the replica included
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// WriteProxyError answers a request that couldn't be proxied, with 504 if it timed out and 502 otherwise
+func WriteProxyError(w http.ResponseWriter, r *http.Request, err error) {
+	if IsTimeout(err) {
+		WriteError(w, r, http.StatusGatewayTimeout)
+		return
+	}
+	WriteError(w, r, http.StatusBadGateway)
+}
+
+// WriteError responds to a request with an HTTP status, which is translated
+// to the matching gRPC status for gRPC calls since gRPC clients ignore HTTP statuses
+func WriteError(w http.ResponseWriter, r *http.Request, status int) {
+	if !IsGRPC(r) {
+		w.WriteHeader(status)
+		return
+	}
+	// A trailers-only response, the status is sent in the headers and no message follows
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(GRPCStatus(status)))
+	w.Header().Set("Grpc-Message", url.PathEscape(http.StatusText(status)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// GRPCStatus maps an HTTP status to a gRPC status, as gRPC clients do for responses without a gRPC status
+// See https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md
+func GRPCStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return GRPCInternal
+	case http.StatusUnauthorized:
+		return GRPCUnauthenticated
+	case http.StatusForbidden:
+		return GRPCPermissionDenied
+	case http.StatusNotFound:
+		return GRPCUnimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GRPCUnavailable
+	default:
+		return GRPCUnknown
+	}
+}
@@ -1,13 +1,19 @@
 package common
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
-	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Mo-Fatah/mizan/internal/pkg/breaker"
 	"github.com/Mo-Fatah/mizan/internal/pkg/config"
 )
 
@@ -22,13 +28,80 @@ type Server struct {
 	// weight is used by the Weighted Round Robin balancer, defaults to 1 if not specified
 	weight uint32
 	// alive is used by the Balancer's Health Checker
-	alive bool
+	alive atomic.Bool
+	// tlsConfig is the TLS config of the connections to an https server, nil for the defaults
+	tlsConfig *tls.Config
+	// breaker is the circuit breaker of the server, nil if its service has none
+	breaker *breaker.Breaker
+	// maxInFlight is the number of requests that can be in flight to the server, no limit if 0
+	maxInFlight int32
+	inFlight    int32
+	// observer is given the latency of the requests proxied to the server, nil if it's not measured
+	observer func(latency time.Duration, failed bool)
+	// onRelease is called once a request in flight gives its room back, nil if nothing waits for it
+	onRelease func()
+}
+
+// NewServer creates a server for a replica of a service. tlsConfig is used to connect to an https replica,
+// it's shared by the replicas of the service and may be nil for the defaults.
+func NewServer(replica *config.Replica, service *config.Service, tlsConfig *tls.Config) *Server {
+	server := newServer(replica, service.Name)
+	serverUrl := server.url
+
+	socket := ""
+	target := serverUrl
+	if serverUrl.Scheme == "unix" {
+		// Requests are sent over the socket to whichever host, the one of the requests sent to local servers
+		socket = serverUrl.Path
+		target = &url.URL{Scheme: "http", Host: "localhost"}
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = newTransport(service.Protocol, service.Timeouts, tlsConfig, socket)
+	if service.Protocol == config.H2 || service.Protocol == config.H2C {
+		// Responses are streamed as they come, e.g. gRPC streams
+		proxy.FlushInterval = -1
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		result := breaker.Success
+		if resp.StatusCode >= http.StatusInternalServerError {
+			result = breaker.Failure
+		}
+		server.done(result)
+		server.observe(resp.Request, result)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Error while proxying to %s: %s", serverUrl, err)
+		result := breaker.Failure
+		if errors.Is(err, context.Canceled) {
+			// The client went away, which tells nothing about the server
+			result = breaker.Ignored
+		}
+		server.done(result)
+		server.observe(r, result)
+		if sink, ok := r.Context().Value(errorSinkKey{}).(*error); ok {
+			*sink = err
+			return
+		}
+		WriteProxyError(w, r, err)
+	}
+	server.proxy = proxy
+	server.tlsConfig = tlsConfig
+	if service.CircuitBreaker != nil {
+		server.breaker = breaker.NewBreaker(replica.Url, service.CircuitBreaker)
+	}
+	if service.Concurrency != nil {
+		server.maxInFlight = int32(server.GetMetaOrDefaultInt("max_in_flight", service.Concurrency.MaxInFlightPerReplica))
+	}
+	return server
+}
 
-	mu *sync.Mutex
+// NewL4Server creates a server for a replica of a TCP or UDP service, whose connections or datagrams are proxied by the caller
+func NewL4Server(replica *config.Replica, serviceName string) *Server {
+	return newServer(replica, serviceName)
 }
 
-// TODO (Mo-Fatah): Refactor this to use the Service struct as a parameter
-func NewServer(replica *config.Replica, serviceName string) *Server {
+func newServer(replica *config.Replica, serviceName string) *Server {
 	serverUrl, err := url.Parse(replica.Url)
 	if err != nil {
 		log.Fatal(err)
@@ -41,36 +114,166 @@ func NewServer(replica *config.Replica, serviceName string) *Server {
 
 	server := &Server{
 		url:         serverUrl,
-		proxy:       httputil.NewSingleHostReverseProxy(serverUrl),
 		metaData:    metaData,
-		alive:       false,
 		serviceName: serviceName,
-		mu:          &sync.Mutex{},
 	}
 	server.weight = server.GetMetaOrDefaultInt("weight", 1)
 	return server
 }
 
+type errorSinkKey struct{}
+
+// WithErrorSink returns a request whose proxying error is stored in sink rather than answered,
+// leaving the answer to the caller, e.g. to retry the request
+func WithErrorSink(r *http.Request, sink *error) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), errorSinkKey{}, sink))
+}
+
+type startKey struct{}
+
+// Proxy proxies a request to the server, which must have been picked with Allow
 func (s *Server) Proxy(w http.ResponseWriter, r *http.Request) {
+	defer s.release()
+	if s.observer != nil {
+		r = r.WithContext(context.WithValue(r.Context(), startKey{}, time.Now()))
+	}
 	s.proxy.ServeHTTP(w, r)
 }
 
+// SetObserver sets the function given the latency of each request proxied to the server until its response headers,
+// and whether it failed. Requests canceled by their client aren't observed.
+func (s *Server) SetObserver(observer func(latency time.Duration, failed bool)) {
+	s.observer = observer
+}
+
+// SetOnRelease sets the function called once a request in flight to the server gives its room back,
+// e.g. to wake up the requests waiting for a replica with room. Only called if the requests in flight are limited.
+func (s *Server) SetOnRelease(onRelease func()) {
+	s.onRelease = onRelease
+}
+
+func (s *Server) observe(r *http.Request, result breaker.Result) {
+	if s.observer == nil || result == breaker.Ignored {
+		return
+	}
+	if start, ok := r.Context().Value(startKey{}).(time.Time); ok {
+		s.observer(time.Since(start), result == breaker.Failure)
+	}
+}
+
 func (s *Server) IsAlive() bool {
-	return s.alive
+	return s.alive.Load()
+}
+
+// Allow tells whether a request can be sent to the server: it's alive, has room for the request
+// and its circuit breaker lets the request through. The room is taken until the request has been proxied.
+// Balancers pick servers with it, a picked server that's eventually not sent the request must be given back with Skip.
+func (s *Server) Allow() bool {
+	if !s.IsAlive() || !s.acquire() {
+		return false
+	}
+	if s.breaker != nil && !s.breaker.Allow() {
+		s.release()
+		return false
+	}
+	return true
+}
+
+// Skip gives back a server picked by a balancer that isn't sent the request after all
+func (s *Server) Skip() {
+	s.release()
+	s.done(breaker.Ignored)
+}
+
+// Busy tells whether the server is alive but has no room for another request
+func (s *Server) Busy() bool {
+	return s.IsAlive() && s.maxInFlight > 0 && atomic.LoadInt32(&s.inFlight) >= s.maxInFlight
+}
+
+// InFlight returns the number of requests in flight to the server, only counted if they're limited
+func (s *Server) InFlight() int {
+	return int(atomic.LoadInt32(&s.inFlight))
+}
+
+func (s *Server) acquire() bool {
+	if s.maxInFlight == 0 {
+		return true
+	}
+	for {
+		inFlight := atomic.LoadInt32(&s.inFlight)
+		if inFlight >= s.maxInFlight {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&s.inFlight, inFlight, inFlight+1) {
+			return true
+		}
+	}
+}
+
+func (s *Server) release() {
+	if s.maxInFlight > 0 {
+		atomic.AddInt32(&s.inFlight, -1)
+		if s.onRelease != nil {
+			s.onRelease()
+		}
+	}
+}
+
+// SetBreaker replaces the circuit breaker of the server, e.g. with the one of the server it replaces on reload
+// so that the state of the breaker is kept
+func (s *Server) SetBreaker(b *breaker.Breaker) {
+	s.breaker = b
+}
+
+// GetBreaker returns the circuit breaker of the server, nil if its service has none
+func (s *Server) GetBreaker() *breaker.Breaker {
+	return s.breaker
+}
+
+func (s *Server) done(result breaker.Result) {
+	if s.breaker != nil {
+		s.breaker.Done(result)
+	}
 }
 
 func (s *Server) SetLiveness(alive bool) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	old := s.alive
-	s.alive = alive
-	return old
+	return s.alive.Swap(alive)
 }
 
 func (s *Server) GetUrl() *url.URL {
 	return s.url
 }
 
+// GetNetwork returns the network of the server, as used by net.Dial
+func (s *Server) GetNetwork() string {
+	switch s.url.Scheme {
+	case "unix", "udp":
+		return s.url.Scheme
+	default:
+		return "tcp"
+	}
+}
+
+// GetAddress returns the host and port of the server, the port defaulting to the one of its scheme,
+// or the path of the socket of a Unix domain socket server
+func (s *Server) GetAddress() string {
+	if s.url.Scheme == "unix" {
+		return s.url.Path
+	}
+	if s.url.Port() != "" {
+		return s.url.Host
+	}
+	if s.url.Scheme == "https" {
+		return net.JoinHostPort(s.url.Hostname(), "443")
+	}
+	return net.JoinHostPort(s.url.Hostname(), "80")
+}
+
+// GetTLSConfig returns the TLS config of the connections to an https server, nil for the defaults
+func (s *Server) GetTLSConfig() *tls.Config {
+	return s.tlsConfig
+}
+
 // TODO (Mo-Fatah): Implement this
 func (s *Server) GetServiceName() string {
 	return s.serviceName
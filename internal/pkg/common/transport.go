@@ -0,0 +1,97 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"golang.org/x/net/http2"
+)
+
+// newTransport builds the transport to the replicas of a service speaking the given protocol.
+// The connections are made to the given Unix domain socket if it's set.
+func newTransport(protocol string, timeouts config.ServiceTimeouts, tlsConfig *tls.Config, socket string) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: timeouts.ConnectOrDefault(), KeepAlive: 30 * time.Second}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket != "" {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	var transport http.RoundTripper
+	switch protocol {
+	case config.H2:
+		transport = &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLSContext: func(ctx context.Context, network, addr string, c *tls.Config) (net.Conn, error) {
+				tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c}
+				return tlsDialer.DialContext(ctx, network, addr)
+			},
+		}
+	case config.H2C:
+		transport = &http2.Transport{
+			AllowHTTP: true,
+			// The connections are dialed as TLS ones, h2c runs over plain TCP or the socket
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}
+	default:
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = tlsConfig
+		httpTransport.DialContext = dial
+		if protocol == config.HTTP1 {
+			// An empty TLSNextProto keeps the transport from negotiating HTTP/2
+			httpTransport.ForceAttemptHTTP2 = false
+			httpTransport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+		transport = httpTransport
+	}
+
+	if timeouts.ResponseHeader > 0 {
+		transport = &headerTimeoutTransport{RoundTripper: transport, timeout: timeouts.ResponseHeader}
+	}
+	return transport
+}
+
+// timeoutError is a net.Error timing out
+type timeoutError string
+
+func (e timeoutError) Error() string   { return string(e) }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+var errResponseHeaderTimeout = timeoutError("timeout awaiting response headers")
+
+// headerTimeoutTransport fails the requests whose response headers don't come in time, whatever the protocol
+type headerTimeoutTransport struct {
+	http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *headerTimeoutTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// The context is released along with the one of the request once the response has been proxied
+	ctx, cancel := context.WithCancel(r.Context())
+	var timedOut int32
+	timer := time.AfterFunc(t.timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		cancel()
+	})
+	resp, err := t.RoundTripper.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() && atomic.LoadInt32(&timedOut) == 1 {
+		// The headers came too late, the body can't be read anymore
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel()
+	}
+	return resp, err
+}
@@ -0,0 +1,80 @@
+package config
+
+import "time"
+
+// CircuitBreaker stops sending requests to a replica that fails too many of them, before its health checks notice.
+// Failures are the requests that couldn't be proxied, and the responses with a 5xx status.
+type CircuitBreaker struct {
+	// Window is the sliding window the error rate is computed over, defaults to 10s
+	Window time.Duration `yaml:"window"`
+	// MinRequests is the number of requests in the window below which the error rate isn't considered, defaults to 20
+	MinRequests int `yaml:"min_requests"`
+	// ErrorRate is the percentage of failed requests in the window that opens the breaker, defaults to 50
+	ErrorRate float64 `yaml:"error_rate"`
+	// ConsecutiveFailures is the number of failures in a row that opens the breaker, defaults to 5
+	ConsecutiveFailures int `yaml:"consecutive_failures"`
+	// OpenTimeout is how long the breaker stays open before letting requests probe the replica, defaults to 30s
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+	// HalfOpenSuccesses is the number of probes that must succeed in a row to close the breaker, defaults to 2
+	HalfOpenSuccesses int `yaml:"half_open_successes"`
+}
+
+// WindowOrDefault returns the sliding window of the error rate
+func (b *CircuitBreaker) WindowOrDefault() time.Duration {
+	if b.Window == 0 {
+		return 10 * time.Second
+	}
+	return b.Window
+}
+
+// MinRequestsOrDefault returns the number of requests below which the error rate isn't considered
+func (b *CircuitBreaker) MinRequestsOrDefault() int {
+	if b.MinRequests == 0 {
+		return 20
+	}
+	return b.MinRequests
+}
+
+// ErrorRateOrDefault returns the percentage of failed requests that opens the breaker
+func (b *CircuitBreaker) ErrorRateOrDefault() float64 {
+	if b.ErrorRate == 0 {
+		return 50
+	}
+	return b.ErrorRate
+}
+
+// ConsecutiveFailuresOrDefault returns the number of failures in a row that opens the breaker
+func (b *CircuitBreaker) ConsecutiveFailuresOrDefault() int {
+	if b.ConsecutiveFailures == 0 {
+		return 5
+	}
+	return b.ConsecutiveFailures
+}
+
+// OpenTimeoutOrDefault returns how long the breaker stays open
+func (b *CircuitBreaker) OpenTimeoutOrDefault() time.Duration {
+	if b.OpenTimeout == 0 {
+		return 30 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+// HalfOpenSuccessesOrDefault returns the number of probes that must succeed to close the breaker
+func (b *CircuitBreaker) HalfOpenSuccessesOrDefault() int {
+	if b.HalfOpenSuccesses == 0 {
+		return 2
+	}
+	return b.HalfOpenSuccesses
+}
+
+func validateCircuitBreaker(verr *ValidationError, service string, b *CircuitBreaker) {
+	if b.Window < 0 || b.OpenTimeout < 0 {
+		verr.add("window and open_timeout of the circuit breaker of service %s must not be negative", service)
+	}
+	if b.MinRequests < 0 || b.ConsecutiveFailures < 0 || b.HalfOpenSuccesses < 0 {
+		verr.add("min_requests, consecutive_failures and half_open_successes of the circuit breaker of service %s must not be negative", service)
+	}
+	if b.ErrorRate < 0 || b.ErrorRate > 100 {
+		verr.add("error_rate of the circuit breaker of service %s must be between 0 and 100", service)
+	}
+}
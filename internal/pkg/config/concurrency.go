@@ -0,0 +1,150 @@
+package config
+
+import "time"
+
+// Concurrency limits the requests in flight to a service and to each of its replicas.
+// Requests over the limits wait in a queue until there's room, or are answered with 503.
+type Concurrency struct {
+	// MaxInFlight is the number of requests in flight to the service, no limit if unset
+	MaxInFlight int `yaml:"max_in_flight"`
+	// MaxInFlightPerReplica is the number of requests in flight to each replica, overridden by the max_in_flight
+	// metadata of a replica. No limit if unset
+	MaxInFlightPerReplica int `yaml:"max_in_flight_per_replica"`
+	// Queue holds the requests over the limits until there's room
+	Queue ConcurrencyQueue `yaml:"queue"`
+	// Adaptive adjusts the number of requests in flight to the service to the latency of its replicas,
+	// instead of max_in_flight
+	Adaptive *AdaptiveConcurrency `yaml:"adaptive"`
+}
+
+// Algorithms of the adaptive concurrency limits
+const (
+	// The limit follows the ratio of the long-term latency to the recent one
+	AdaptiveGradient = "gradient"
+	// The limit grows by one with each request, and shrinks by a ratio with slow or failed requests
+	AdaptiveAIMD = "aimd"
+)
+
+// AdaptiveConcurrency discovers how many requests in flight the replicas of a service can sustain from their latency
+type AdaptiveConcurrency struct {
+	// Algorithm is one of "gradient" and "aimd", defaults to gradient
+	Algorithm string `yaml:"algorithm"`
+	// InitialLimit defaults to 20
+	InitialLimit int `yaml:"initial_limit"`
+	// MinLimit defaults to 1
+	MinLimit int `yaml:"min_limit"`
+	// MaxLimit defaults to 1000
+	MaxLimit int `yaml:"max_limit"`
+	// Tolerance is how much the latency may grow over its long-term average before the gradient limit shrinks, defaults to 1.5
+	Tolerance float64 `yaml:"tolerance"`
+	// LatencyThreshold is the latency over which requests shrink the aimd limit, defaults to 1s
+	LatencyThreshold time.Duration `yaml:"latency_threshold"`
+	// BackoffRatio is what the aimd limit is multiplied by when it shrinks, defaults to 0.9
+	BackoffRatio float64 `yaml:"backoff_ratio"`
+}
+
+// ConcurrencyQueue holds the requests over the concurrency limits of a service
+type ConcurrencyQueue struct {
+	// Size is the number of requests that can wait, the requests over the limits are answered right away if unset
+	Size int `yaml:"size"`
+	// Timeout is how long a request can wait, defaults to 1s
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// TimeoutOrDefault returns how long a request can wait in the queue
+func (q *ConcurrencyQueue) TimeoutOrDefault() time.Duration {
+	if q.Timeout == 0 {
+		return time.Second
+	}
+	return q.Timeout
+}
+
+// AlgorithmOrDefault returns the algorithm of the limit
+func (a *AdaptiveConcurrency) AlgorithmOrDefault() string {
+	if a.Algorithm == "" {
+		return AdaptiveGradient
+	}
+	return a.Algorithm
+}
+
+// InitialLimitOrDefault returns the limit before any request
+func (a *AdaptiveConcurrency) InitialLimitOrDefault() int {
+	if a.InitialLimit == 0 {
+		return 20
+	}
+	return a.InitialLimit
+}
+
+// MinLimitOrDefault returns the lowest limit
+func (a *AdaptiveConcurrency) MinLimitOrDefault() int {
+	if a.MinLimit == 0 {
+		return 1
+	}
+	return a.MinLimit
+}
+
+// MaxLimitOrDefault returns the highest limit
+func (a *AdaptiveConcurrency) MaxLimitOrDefault() int {
+	if a.MaxLimit == 0 {
+		return 1000
+	}
+	return a.MaxLimit
+}
+
+// ToleranceOrDefault returns how much the latency may grow before the gradient limit shrinks
+func (a *AdaptiveConcurrency) ToleranceOrDefault() float64 {
+	if a.Tolerance == 0 {
+		return 1.5
+	}
+	return a.Tolerance
+}
+
+// LatencyThresholdOrDefault returns the latency over which requests shrink the aimd limit
+func (a *AdaptiveConcurrency) LatencyThresholdOrDefault() time.Duration {
+	if a.LatencyThreshold == 0 {
+		return time.Second
+	}
+	return a.LatencyThreshold
+}
+
+// BackoffRatioOrDefault returns what the aimd limit is multiplied by when it shrinks
+func (a *AdaptiveConcurrency) BackoffRatioOrDefault() float64 {
+	if a.BackoffRatio == 0 {
+		return 0.9
+	}
+	return a.BackoffRatio
+}
+
+func validateConcurrency(verr *ValidationError, service string, c *Concurrency) {
+	if c.MaxInFlight < 0 || c.MaxInFlightPerReplica < 0 {
+		verr.add("max_in_flight and max_in_flight_per_replica of service %s must not be negative", service)
+	}
+	if c.Queue.Size < 0 || c.Queue.Timeout < 0 {
+		verr.add("size and timeout of the queue of service %s must not be negative", service)
+	}
+	if c.Adaptive != nil {
+		validateAdaptiveConcurrency(verr, service, c)
+	}
+}
+
+func validateAdaptiveConcurrency(verr *ValidationError, service string, c *Concurrency) {
+	a := c.Adaptive
+	if c.MaxInFlight != 0 {
+		verr.add("service %s must set either max_in_flight or an adaptive concurrency limit", service)
+	}
+	if algorithm := a.AlgorithmOrDefault(); algorithm != AdaptiveGradient && algorithm != AdaptiveAIMD {
+		verr.add("unknown adaptive concurrency algorithm %q of service %s, it must be gradient or aimd", algorithm, service)
+	}
+	if a.InitialLimit < 0 || a.MinLimit < 0 || a.MaxLimit < 0 || a.LatencyThreshold < 0 {
+		verr.add("limits and latency_threshold of the adaptive concurrency of service %s must not be negative", service)
+	}
+	if a.Tolerance != 0 && a.Tolerance < 1 {
+		verr.add("tolerance of the adaptive concurrency of service %s must be at least 1", service)
+	}
+	if initial := a.InitialLimitOrDefault(); initial < a.MinLimitOrDefault() || initial > a.MaxLimitOrDefault() {
+		verr.add("initial_limit of the adaptive concurrency of service %s must be between min_limit and max_limit", service)
+	}
+	if a.BackoffRatio < 0 || a.BackoffRatio >= 1 {
+		verr.add("backoff_ratio of the adaptive concurrency of service %s must be between 0 and 1", service)
+	}
+}
@@ -1,33 +1,157 @@
 package config
 
 import (
+	"errors"
 	"io"
 	"os"
-
-	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"time"
 )
 
 type Config struct {
+	// Include lists other config files, globs or directories whose services are merged into this config.
+	// Relative paths are relative to the directory of the including file.
+	Include  []string  `yaml:"include,omitempty"`
 	Services []Service `yaml:"services"`
 	Strategy string    `yaml:"strategy"`
-	// Ports to which Mizan will listen on
+	// Ports are plain HTTP listeners on all interfaces, kept for compatibility with the configs predating listeners
 	// TODO (Mo-Fatah): Should deal with distributed ports across multiple nodes
-	Ports          []int  `yaml:"ports"`
-	MaxConnections uint32 `yaml:"max_connections"`
+	Ports []int `yaml:"ports"`
+	// Listeners are the addresses and sockets Mizan listens on, with their own settings such as TLS.
+	// Like the ports, they're only read on startup, except for the services they expose.
+	Listeners      []Listener `yaml:"listeners"`
+	MaxConnections uint32     `yaml:"max_connections"`
+	// Admin configures the admin API, which is disabled if no address is set
+	Admin Admin `yaml:"admin"`
+	// History configures the history of the applied configs
+	History History `yaml:"history"`
+	// Upgrades configures the connections upgraded from HTTP, such as WebSockets
+	Upgrades Upgrades `yaml:"upgrades"`
+	// RetryBudget caps the retries of all the services
+	RetryBudget RetryBudget `yaml:"retry_budget"`
+	// Priority assigns priority classes to the requests, shedding the lowest ones first on overload
+	Priority Priority `yaml:"priority"`
+	// TCP are the services balanced at layer 4, each on its own port.
+	// Their ports, like the HTTP ones, are only read on startup.
+	TCP []TCPService `yaml:"tcp"`
+	// UDP are the services whose datagrams are balanced, each on its own port. Their ports are only read on startup.
+	UDP []UDPService `yaml:"udp"`
+
+	// problems found while loading the config, reported by Validate
+	problems []string
+	// secrets maps the secret values expanded in the config to the references they were expanded from
+	secrets map[string]string
+	// sources are the absolute paths of all the files the config was loaded from
+	sources []string
+	// includePatterns are the absolute glob patterns of the included files
+	includePatterns []string
 }
 
 type Service struct {
 	Name     string     `yaml:"name"`
 	Matcher  string     `yaml:"matcher"`
 	Replicas []*Replica `yaml:"replicas"`
+	// ClientAuth authenticates the clients of the service by their certificates (mTLS).
+	// TLS listeners request client certificates from clients when any service has client authentication.
+	ClientAuth *ClientAuth `yaml:"client_auth"`
+	// UpstreamTLS configures the TLS connections to the https replicas
+	UpstreamTLS *UpstreamTLS `yaml:"upstream_tls"`
+	// Protocol is the protocol spoken to the replicas, one of "http1", "h2" and "h2c".
+	// If unset, HTTP/2 is used with https replicas that support it and HTTP/1.1 otherwise.
+	Protocol string `yaml:"protocol"`
+	// Timeouts of the requests proxied to the replicas
+	Timeouts ServiceTimeouts `yaml:"timeouts"`
+	// Retries retries the failed requests on other replicas, they're not retried if unset
+	Retries *Retries `yaml:"retries"`
+	// CircuitBreaker stops sending requests to the replicas failing too many of them, each replica having its own breaker
+	CircuitBreaker *CircuitBreaker `yaml:"circuit_breaker"`
+	// RateLimits limit the requests made by each client, API key or user, a request must be allowed by all of them
+	RateLimits []RateLimit `yaml:"rate_limits"`
+	// Concurrency limits the requests in flight to the service and its replicas, they're not limited if unset
+	Concurrency *Concurrency `yaml:"concurrency"`
+	// Priority is the priority class of the requests to the service, the default class if unset
+	Priority string `yaml:"priority"`
+
+	// source is the absolute path of the file that defined the service
+	source string
+}
+
+// ServiceTimeouts are the timeouts of the requests proxied to the replicas of a service.
+// Requests timing out before the response has started are answered with 504.
+type ServiceTimeouts struct {
+	// Connect is how long connecting to a replica may take, defaults to 30s
+	Connect time.Duration `yaml:"connect"`
+	// ResponseHeader is how long the headers of the response may take to come, connecting included. No limit if unset
+	ResponseHeader time.Duration `yaml:"response_header"`
+	// Total is how long a request may take as a whole, the body of the response included. No limit if unset.
+	// Upgraded connections aren't limited, they have their own idle timeout
+	Total time.Duration `yaml:"total"`
+}
+
+// ConnectOrDefault returns how long connecting to a replica may take
+func (t *ServiceTimeouts) ConnectOrDefault() time.Duration {
+	if t.Connect == 0 {
+		return 30 * time.Second
+	}
+	return t.Connect
+}
+
+// Admin and History are only read on startup, changing them requires a restart
+type Admin struct {
+	// Address the admin API listens on, e.g. "127.0.0.1:9900"
+	Address string `yaml:"address"`
+}
+
+type History struct {
+	// Limit is the number of applied configs to keep
+	Limit int `yaml:"limit"`
+	// Dir is where the applied configs are stored so that they survive restarts, they're only kept in memory if unset
+	Dir string `yaml:"dir"`
+}
+
+type Upgrades struct {
+	// IdleTimeout closes upgraded connections without traffic in either direction for that long, defaults to 1h
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// DrainTimeout is how long upgraded connections are given to finish on shutdown, or when their replica is
+	// removed by a reload, before they're closed. Defaults to 30s
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+// IdleTimeoutOrDefault returns the idle timeout of upgraded connections
+func (u Upgrades) IdleTimeoutOrDefault() time.Duration {
+	if u.IdleTimeout == 0 {
+		return time.Hour
+	}
+	return u.IdleTimeout
+}
+
+// DrainTimeoutOrDefault returns how long upgraded connections are given to finish
+func (u Upgrades) DrainTimeoutOrDefault() time.Duration {
+	if u.DrainTimeout == 0 {
+		return 30 * time.Second
+	}
+	return u.DrainTimeout
 }
 
 type Replica struct {
 	Url      string            `yaml:"url"`
-	MetaData map[string]string `yaml:"metadata"`
+	MetaData map[string]string `yaml:"metadata,omitempty"`
 }
 
+// LoadConfig loads the config file at filePath along with the files it includes
 func LoadConfig(filePath string) (*Config, error) {
+	config, err := loadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.include(filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadFile loads a single config file, without the files it includes
+func loadFile(filePath string) (*Config, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
@@ -39,11 +163,45 @@ func LoadConfig(filePath string) (*Config, error) {
 		return nil, err
 	}
 
-	config := Config{}
+	config, err := Parse(buf, FormatOf(filePath))
+	if err != nil {
+		return nil, err
+	}
 
-	if err = yaml.Unmarshal(buf, &config); err != nil {
+	source, err := filepath.Abs(filePath)
+	if err != nil {
 		return nil, err
 	}
+	config.sources = []string{source}
+	for i := range config.Services {
+		config.Services[i].source = source
+	}
+	return config, nil
+}
+
+// Parse decodes a config, expanding environment variables and files referenced in its values.
+// Includes are only resolved by LoadConfig, since they're relative to the config file.
+func Parse(buf []byte, format Format) (*Config, error) {
+	root, err := decode(buf, format)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Config{}
+	// An empty document, left to Validate to complain about
+	if root.Kind == 0 {
+		return &config, nil
+	}
+
+	in := newInterpolator()
+	in.expandNode(root)
+	if err := root.Decode(&config); err != nil {
+		// Decoding errors quote the offending values, which may be secrets
+		config.secrets = in.secrets
+		return nil, errors.New(config.Redact(err.Error()))
+	}
+	config.problems = in.problems
+	config.secrets = in.secrets
 
 	return &config, nil
 }
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "+"
+	Removed  ChangeKind = "-"
+	Modified ChangeKind = "~"
+)
+
+// Change describes a single difference between two configs
+type Change struct {
+	Kind ChangeKind
+	// Path identifies what changed, e.g. `services["/api/v1"].replicas["http://localhost:9090"].weight`
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff returns the changes that would be applied when reloading from one config to another.
+// Services are identified by their matcher and replicas by their url, since that's how Mizan routes to them.
+func Diff(from, to *Config) []Change {
+	changes := make([]Change, 0)
+	modified := func(path, o, n string) {
+		if o != n {
+			changes = append(changes, Change{Kind: Modified, Path: path, Old: o, New: n})
+		}
+	}
+
+	modified("strategy", strategyOrDefault(from.Strategy), strategyOrDefault(to.Strategy))
+	modified("max_connections", fmt.Sprint(from.MaxConnections), fmt.Sprint(to.MaxConnections))
+	modified("ports", fmt.Sprint(from.Ports), fmt.Sprint(to.Ports))
+	modified("listeners", describeListeners(from), describeListeners(to))
+	modified("upgrades", describeSettings(&from.Upgrades), describeSettings(&to.Upgrades))
+	modified("retry_budget", describeSettings(&from.RetryBudget), describeSettings(&to.RetryBudget))
+	modified("priority", describeSettings(&from.Priority), describeSettings(&to.Priority))
+
+	oldServices := servicesByMatcher(from)
+	newServices := servicesByMatcher(to)
+	for _, matcher := range sortedKeys(oldServices, newServices) {
+		path := fmt.Sprintf("services[%q]", matcher)
+		oldService, inOld := oldServices[matcher]
+		newService, inNew := newServices[matcher]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, Path: path, Old: describeService(oldService)})
+		case !inOld:
+			changes = append(changes, Change{Kind: Added, Path: path, New: describeService(newService)})
+		default:
+			modified(path+".name", oldService.Name, newService.Name)
+			modified(path+".protocol", oldService.Protocol, newService.Protocol)
+			modified(path+".client_auth", describeSettings(oldService.ClientAuth), describeSettings(newService.ClientAuth))
+			modified(path+".upstream_tls", describeSettings(oldService.UpstreamTLS), describeSettings(newService.UpstreamTLS))
+			modified(path+".timeouts", describeSettings(&oldService.Timeouts), describeSettings(&newService.Timeouts))
+			modified(path+".retries", describeSettings(oldService.Retries), describeSettings(newService.Retries))
+			modified(path+".circuit_breaker", describeSettings(oldService.CircuitBreaker), describeSettings(newService.CircuitBreaker))
+			modified(path+".rate_limits", fmt.Sprintf("%+v", oldService.RateLimits), fmt.Sprintf("%+v", newService.RateLimits))
+			modified(path+".concurrency", describeSettings(oldService.Concurrency), describeSettings(newService.Concurrency))
+			modified(path+".priority", oldService.Priority, newService.Priority)
+			changes = append(changes, diffReplicas(path, oldService.Replicas, newService.Replicas)...)
+		}
+	}
+
+	oldTCP := tcpServicesByPort(from)
+	newTCP := tcpServicesByPort(to)
+	for _, port := range sortedKeys(oldTCP, newTCP) {
+		path := fmt.Sprintf("tcp[%s]", port)
+		oldService, inOld := oldTCP[port]
+		newService, inNew := newTCP[port]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, Path: path, Old: describeReplicas(oldService.Name, oldService.Replicas)})
+		case !inOld:
+			changes = append(changes, Change{Kind: Added, Path: path, New: describeReplicas(newService.Name, newService.Replicas)})
+		default:
+			modified(path+".name", oldService.Name, newService.Name)
+			modified(path+".address", oldService.Address, newService.Address)
+			modified(path+".connect_timeout", oldService.ConnectTimeout.String(), newService.ConnectTimeout.String())
+			modified(path+".idle_timeout", oldService.IdleTimeout.String(), newService.IdleTimeout.String())
+			modified(path+".drain_timeout", oldService.DrainTimeout.String(), newService.DrainTimeout.String())
+			modified(path+".proxy_protocol", describeSettings(oldService.ProxyProtocol), describeSettings(newService.ProxyProtocol))
+			modified(path+".send_proxy_protocol", oldService.SendProxyProtocol, newService.SendProxyProtocol)
+			changes = append(changes, diffReplicas(path, oldService.Replicas, newService.Replicas)...)
+		}
+	}
+
+	oldUDP := udpServicesByPort(from)
+	newUDP := udpServicesByPort(to)
+	for _, port := range sortedKeys(oldUDP, newUDP) {
+		path := fmt.Sprintf("udp[%s]", port)
+		oldService, inOld := oldUDP[port]
+		newService, inNew := newUDP[port]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, Path: path, Old: describeReplicas(oldService.Name, oldService.Replicas)})
+		case !inOld:
+			changes = append(changes, Change{Kind: Added, Path: path, New: describeReplicas(newService.Name, newService.Replicas)})
+		default:
+			modified(path+".name", oldService.Name, newService.Name)
+			modified(path+".address", oldService.Address, newService.Address)
+			modified(path+".session_timeout", oldService.SessionTimeout.String(), newService.SessionTimeout.String())
+			modified(path+".max_sessions", fmt.Sprint(oldService.MaxSessions), fmt.Sprint(newService.MaxSessions))
+			changes = append(changes, diffReplicas(path, oldService.Replicas, newService.Replicas)...)
+		}
+	}
+	return changes
+}
+
+func diffReplicas(servicePath string, from, to []*Replica) []Change {
+	changes := make([]Change, 0)
+	oldReplicas := replicasByUrl(from)
+	newReplicas := replicasByUrl(to)
+	for _, url := range sortedKeys(oldReplicas, newReplicas) {
+		path := fmt.Sprintf("%s.replicas[%q]", servicePath, url)
+		oldReplica, inOld := oldReplicas[url]
+		newReplica, inNew := newReplicas[url]
+		switch {
+		case !inNew:
+			changes = append(changes, Change{Kind: Removed, Path: path, Old: "weight " + oldReplica.weight()})
+		case !inOld:
+			changes = append(changes, Change{Kind: Added, Path: path, New: "weight " + newReplica.weight()})
+		case oldReplica.weight() != newReplica.weight():
+			changes = append(changes, Change{Kind: Modified, Path: path + ".weight", Old: oldReplica.weight(), New: newReplica.weight()})
+		}
+	}
+	return changes
+}
+
+func describeService(s *Service) string {
+	return describeReplicas(s.Name, s.Replicas)
+}
+
+func describeReplicas(name string, replicas []*Replica) string {
+	urls := make([]string, 0, len(replicas))
+	for _, replica := range replicas {
+		urls = append(urls, replica.Url)
+	}
+	return fmt.Sprintf("%q with replicas [%s]", name, strings.Join(urls, ", "))
+}
+
+// describeSettings describes optional settings of a service
+func describeSettings[T any](settings *T) string {
+	if settings == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%+v", *settings)
+}
+
+func describeListeners(c *Config) string {
+	listeners := make([]string, 0, len(c.Listeners))
+	for _, listener := range c.Listeners {
+		description := fmt.Sprint(listener.Port)
+		if listener.Socket != nil {
+			description = "unix:" + listener.Socket.Path
+		} else if listener.Address != "" {
+			description = net.JoinHostPort(listener.Address, description)
+		}
+		if listener.TLS != nil {
+			description += " (tls)"
+		} else if listener.H2C {
+			description += " (h2c)"
+		}
+		if listener.ProxyProtocol != nil {
+			description += " (proxy protocol)"
+		}
+		if len(listener.Services) > 0 {
+			description += fmt.Sprintf(" (services %s)", strings.Join(listener.Services, ", "))
+		}
+		listeners = append(listeners, description)
+	}
+	return "[" + strings.Join(listeners, " ") + "]"
+}
+
+func strategyOrDefault(strategy string) string {
+	if strategy == "" {
+		return "rr"
+	}
+	return strings.ToLower(strategy)
+}
+
+func (r *Replica) weight() string {
+	if weight, ok := r.MetaData["weight"]; ok {
+		return weight
+	}
+	return "1"
+}
+
+func servicesByMatcher(c *Config) map[string]*Service {
+	services := make(map[string]*Service)
+	for i := range c.Services {
+		services[c.Services[i].Matcher] = &c.Services[i]
+	}
+	return services
+}
+
+func tcpServicesByPort(c *Config) map[string]*TCPService {
+	services := make(map[string]*TCPService)
+	for i := range c.TCP {
+		services[fmt.Sprint(c.TCP[i].Port)] = &c.TCP[i]
+	}
+	return services
+}
+
+func udpServicesByPort(c *Config) map[string]*UDPService {
+	services := make(map[string]*UDPService)
+	for i := range c.UDP {
+		services[fmt.Sprint(c.UDP[i].Port)] = &c.UDP[i]
+	}
+	return services
+}
+
+func replicasByUrl(replicas []*Replica) map[string]*Replica {
+	byUrl := make(map[string]*Replica)
+	for _, replica := range replicas {
+		if replica != nil {
+			byUrl[replica.Url] = replica
+		}
+	}
+	return byUrl
+}
+
+// sortedKeys returns the union of the keys of both maps in a stable order
+func sortedKeys[T any](a, b map[string]T) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	from := loadFromString(t, `
+strategy: "rr"
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+      - url: "http://localhost:9091"
+  - matcher: "/api/old"
+    name: "old"
+    replicas:
+      - url: "http://localhost:9095"
+`)
+	to := loadFromString(t, `
+strategy: "wrr"
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+        metadata:
+          weight: 3
+      - url: "http://localhost:9092"
+`)
+
+	changes := Diff(from, to)
+	assert.Equal(t, []Change{
+		{Kind: Modified, Path: "strategy", Old: "rr", New: "wrr"},
+		{Kind: Removed, Path: `services["/api/old"]`, Old: `"old" with replicas [http://localhost:9095]`},
+		{Kind: Modified, Path: `services["/api/v1"].replicas["http://localhost:9090"].weight`, Old: "1", New: "3"},
+		{Kind: Removed, Path: `services["/api/v1"].replicas["http://localhost:9091"]`, Old: "weight 1"},
+		{Kind: Added, Path: `services["/api/v1"].replicas["http://localhost:9092"]`, New: "weight 1"},
+	}, changes)
+
+	assert.Empty(t, Diff(to, to))
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the encoding of a config file
+type Format string
+
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// Extensions of the config files of each format, also the files picked up when a directory is included
+var formatExtensions = map[string]Format{
+	".yml":  YAML,
+	".yaml": YAML,
+	".json": JSON,
+	".toml": TOML,
+}
+
+// FormatOf returns the format of a config file based on its extension, defaulting to YAML
+func FormatOf(filePath string) Format {
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return format
+	}
+	return YAML
+}
+
+// decode decodes a config file of the given format into a YAML node tree.
+// All formats go through the same node tree, so that they share the YAML tags,
+// the interpolation of references and the decoding into the Config model.
+func decode(buf []byte, format Format) (*yaml.Node, error) {
+	root := &yaml.Node{}
+	switch format {
+	case JSON, TOML:
+		var doc map[string]interface{}
+		if format == JSON {
+			if err := json.Unmarshal(buf, &doc); err != nil {
+				return nil, err
+			}
+		} else if err := toml.Unmarshal(buf, &doc); err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			return root, nil
+		}
+		if err := root.Encode(doc); err != nil {
+			return nil, err
+		}
+	case YAML:
+		if err := yaml.Unmarshal(buf, root); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	return root, nil
+}
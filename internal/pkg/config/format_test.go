@@ -0,0 +1,64 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_Formats(t *testing.T) {
+	t.Setenv("MIZAN_TEST_PORT", "8081")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yml": `
+strategy: "wrr"
+max_connections: 1024
+ports: [8080, "${MIZAN_TEST_PORT}"]
+services:
+  - matcher: "/api/v1"
+    name: "test service"
+    replicas:
+      - url: "http://localhost:9090"
+        metadata:
+          weight: 6
+`,
+		"config.json": `{
+	"strategy": "wrr",
+	"max_connections": 1024,
+	"ports": [8080, "${MIZAN_TEST_PORT}"],
+	"services": [{
+		"matcher": "/api/v1",
+		"name": "test service",
+		"replicas": [{"url": "http://localhost:9090", "metadata": {"weight": 6}}]
+	}]
+}`,
+		"config.toml": `
+strategy = "wrr"
+max_connections = 1024
+ports = [8080, "${MIZAN_TEST_PORT}"]
+
+[[services]]
+matcher = "/api/v1"
+name = "test service"
+
+[[services.replicas]]
+url = "http://localhost:9090"
+metadata = { weight = "6" }
+`,
+	})
+
+	expected, err := LoadConfig(filepath.Join(dir, "config.yml"))
+	require.NoError(t, err)
+	require.NoError(t, expected.Validate())
+	for _, name := range []string{"config.json", "config.toml"} {
+		conf, err := LoadConfig(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		require.NoError(t, conf.Validate(), name)
+		assert.Equal(t, expected.Ports, conf.Ports, name)
+		assert.Equal(t, expected.Strategy, conf.Strategy, name)
+		assert.Equal(t, expected.MaxConnections, conf.MaxConnections, name)
+		assert.Empty(t, Diff(expected, conf), name)
+	}
+}
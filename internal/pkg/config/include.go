@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// include loads the files listed in the Include section and merges their services into the config.
+// Included files may only define services, and can't include other files.
+func (c *Config) include(baseDir string) error {
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		patterns, err := expandDir(pattern)
+		if err != nil {
+			return err
+		}
+		c.includePatterns = append(c.includePatterns, patterns...)
+
+		// Files are merged in lexical order, whatever pattern of a directory they matched
+		files := make([]string, 0)
+		for _, p := range patterns {
+			matches, err := filepath.Glob(p)
+			if err != nil {
+				return fmt.Errorf("invalid include pattern %q: %w", p, err)
+			}
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && !info.IsDir() {
+					files = append(files, match)
+				}
+			}
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			if err := c.merge(file); err != nil {
+				return err
+			}
+		}
+		// A glob or a directory may legitimately be empty, but a missing file is most likely a mistake
+		if len(files) == 0 && !hasMeta(pattern) && len(patterns) == 1 {
+			c.problems = append(c.problems, fmt.Sprintf("included file %s does not exist", pattern))
+		}
+	}
+	return nil
+}
+
+// merge loads an included file and appends its services to the config
+func (c *Config) merge(path string) error {
+	included, err := loadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	source := included.sources[0]
+	for _, s := range c.sources {
+		// e.g. a directory including the file that includes it
+		if s == source {
+			return nil
+		}
+	}
+
+	if !included.definesOnlyServices() {
+		c.problems = append(c.problems, fmt.Sprintf("included file %s may only define services", source))
+	}
+	for _, problem := range included.problems {
+		c.problems = append(c.problems, fmt.Sprintf("%s: %s", source, problem))
+	}
+	if c.secrets == nil {
+		c.secrets = make(map[string]string)
+	}
+	for secret, ref := range included.secrets {
+		c.secrets[secret] = ref
+	}
+	c.sources = append(c.sources, source)
+	c.Services = append(c.Services, included.Services...)
+	return nil
+}
+
+// definesOnlyServices tells whether all the settings of the config but its services are unset
+func (c *Config) definesOnlyServices() bool {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.IsExported() && field.Name != "Services" && !v.Field(i).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// expandDir turns a directory into patterns matching the config files in it
+func expandDir(pattern string) ([]string, error) {
+	if hasMeta(pattern) {
+		return []string{pattern}, nil
+	}
+	info, err := os.Stat(pattern)
+	if err != nil || !info.IsDir() {
+		return []string{pattern}, nil
+	}
+	patterns := make([]string, 0, len(formatExtensions))
+	for ext := range formatExtensions {
+		patterns = append(patterns, filepath.Join(pattern, "*"+ext))
+	}
+	sort.Strings(patterns)
+	return patterns, nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// Sources returns the absolute paths of all the files the config was loaded from, starting with the main file
+func (c *Config) Sources() []string {
+	return c.sources
+}
+
+// IncludePatterns returns the absolute glob patterns of the included files,
+// files created later that match one of them will be included on the next load
+func (c *Config) IncludePatterns() []string {
+	return c.includePatterns
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes the given files, keyed by their path relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestLoadConfig_Include(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yml": `
+max_connections: 1024
+include:
+  - conf.d
+  - extra.yml
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+`,
+		"conf.d/a.yml": `
+services:
+  - matcher: "/api/a"
+    name: "a"
+    replicas:
+      - url: "http://localhost:9091"
+`,
+		"conf.d/b.yaml": `
+services:
+  - matcher: "/api/b"
+    name: "b"
+    replicas:
+      - url: "http://localhost:9092"
+`,
+		"conf.d/notes.txt": "not a config file",
+		"extra.yml": `
+services:
+  - matcher: "/api/extra"
+    name: "extra"
+    replicas:
+      - url: "http://localhost:9093"
+`,
+	})
+
+	conf, err := LoadConfig(filepath.Join(dir, "config.yml"))
+	require.NoError(t, err)
+	require.NoError(t, conf.Validate())
+
+	matchers := make([]string, 0)
+	for _, service := range conf.Services {
+		matchers = append(matchers, service.Matcher)
+	}
+	assert.Equal(t, []string{"/api/v1", "/api/a", "/api/b", "/api/extra"}, matchers)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "config.yml"),
+		filepath.Join(dir, "conf.d/a.yml"),
+		filepath.Join(dir, "conf.d/b.yaml"),
+		filepath.Join(dir, "extra.yml"),
+	}, conf.Sources())
+}
+
+func TestLoadConfig_IncludeConflicts(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yml": `
+max_connections: 1024
+include:
+  - "teams/*.yml"
+  - missing.yml
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9090"
+`,
+		"teams/a.yml": `
+strategy: "wrr"
+services:
+  - matcher: "/api/v1"
+    name: "v1"
+    replicas:
+      - url: "http://localhost:9091"
+`,
+	})
+
+	conf, err := LoadConfig(filepath.Join(dir, "config.yml"))
+	require.NoError(t, err)
+	err = conf.Validate()
+	require.Error(t, err)
+
+	verr := err.(*ValidationError)
+	main, team := filepath.Join(dir, "config.yml"), filepath.Join(dir, "teams/a.yml")
+	assert.ElementsMatch(t, []string{
+		"included file " + filepath.Join(dir, "missing.yml") + " does not exist",
+		"included file " + team + " may only define services",
+		`service name "v1" is used more than once (defined in ` + main + " and " + team + ")",
+		`matcher "/api/v1" is used by more than one service (defined in ` + main + " and " + team + ")",
+	}, verr.Problems)
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// redacted replaces secret values in anything that gets logged or printed
+	redacted = "[REDACTED]"
+	// filePrefix marks a reference to a file whose content is used as the value, e.g. ${file:/run/secrets/token}
+	filePrefix = "file:"
+)
+
+// interpolator expands references in config values:
+//   - ${NAME} is replaced by the value of the environment variable NAME
+//   - ${NAME:-default} is replaced by default if NAME is unset or empty
+//   - ${file:/path} is replaced by the content of the file at /path, without trailing newlines
+//   - $${ is an escaped ${ and is left as is
+//
+// Values read from files are considered secrets and are redacted from logs.
+type interpolator struct {
+	// problems are the unresolved references, reported as validation errors
+	problems []string
+	// secrets maps the secret values to the references they were expanded from
+	secrets map[string]string
+}
+
+func newInterpolator() *interpolator {
+	return &interpolator{
+		secrets: make(map[string]string),
+	}
+}
+
+// expandNode expands the references in all the scalar values under node
+func (in *interpolator) expandNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") {
+			return
+		}
+		node.Value = in.expand(node.Value)
+		// Let the expanded value be resolved again, so that e.g. `port: "${PORT}"` decodes into an int.
+		// Quoting a reference is the only option in JSON and TOML, so quoted values are resolved as well.
+		node.Tag = ""
+		node.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.LiteralStyle | yaml.FoldedStyle
+		// Unless it resolves to null, since an empty string is still a string
+		if node.ShortTag() == "!!null" {
+			node.Tag = "!!str"
+		}
+		return
+	}
+	for _, child := range node.Content {
+		in.expandNode(child)
+	}
+}
+
+func (in *interpolator) expand(value string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			out.WriteString(value)
+			return out.String()
+		}
+		if start > 0 && value[start-1] == '$' {
+			out.WriteString(value[:start-1] + "${")
+			value = value[start+2:]
+			continue
+		}
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			in.problems = append(in.problems, fmt.Sprintf("unterminated reference in %q", value))
+			out.WriteString(value)
+			return out.String()
+		}
+		end += start
+
+		out.WriteString(value[:start])
+		out.WriteString(in.resolve(value[start+2 : end]))
+		value = value[end+1:]
+	}
+}
+
+// resolve returns the value of a single reference, without the surrounding ${ and }
+func (in *interpolator) resolve(ref string) string {
+	if strings.HasPrefix(ref, filePrefix) {
+		path := strings.TrimPrefix(ref, filePrefix)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			in.problems = append(in.problems, fmt.Sprintf("unresolved reference ${%s}: %s", ref, err))
+			return ""
+		}
+		secret := strings.TrimRight(string(content), "\r\n")
+		if secret != "" {
+			in.secrets[secret] = "${" + ref + "}"
+		}
+		return secret
+	}
+
+	name, defaultValue, hasDefault := strings.Cut(ref, ":-")
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if hasDefault {
+		return defaultValue
+	}
+	if _, ok := os.LookupEnv(name); !ok {
+		in.problems = append(in.problems, fmt.Sprintf("unresolved reference ${%s}: environment variable %s is not set", ref, name))
+	}
+	return ""
+}
+
+// Redact replaces the secret values of the config found in s, so that s can be safely logged
+func (c *Config) Redact(s string) string {
+	for secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// Secrets returns the secret values of the config
+func (c *Config) Secrets() []string {
+	secrets := make([]string, 0, len(c.secrets))
+	for secret := range c.secrets {
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig_Interpolation(t *testing.T) {
+	t.Setenv("MIZAN_TEST_HOST", "backend.internal")
+	t.Setenv("MIZAN_TEST_PORT", "8443")
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("s3cr3t\n"), 0600))
+
+	conf := loadFromString(t, `
+max_connections: ${MIZAN_TEST_MAX_CONNECTIONS:-1024}
+ports:
+  - ${MIZAN_TEST_PORT}
+services:
+  - matcher: "/api/v1"
+    name: "price is $${NOT_EXPANDED}"
+    replicas:
+      - url: "http://${MIZAN_TEST_HOST}:9090"
+        metadata:
+          token: "${file:`+tokenPath+`}"
+`)
+	require.NoError(t, conf.Validate())
+	assert.Equal(t, uint32(1024), conf.MaxConnections)
+	assert.Equal(t, []int{8443}, conf.Ports)
+	assert.Equal(t, "price is ${NOT_EXPANDED}", conf.Services[0].Name)
+	assert.Equal(t, "http://backend.internal:9090", conf.Services[0].Replicas[0].Url)
+	assert.Equal(t, "s3cr3t", conf.Services[0].Replicas[0].MetaData["token"])
+
+	assert.Equal(t, "token=[REDACTED]", conf.Redact("token=s3cr3t"))
+}
+
+func TestLoadConfig_UnresolvedReferences(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+services:
+  - matcher: "/api/v1"
+    name: "test service"
+    replicas:
+      - url: "http://${MIZAN_TEST_UNSET_HOST}:9090"
+        metadata:
+          token: "${file:/does/not/exist}"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unresolved reference ${MIZAN_TEST_UNSET_HOST}")
+	assert.Contains(t, err.Error(), "unresolved reference ${file:/does/not/exist}")
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// TCPService balances the raw TCP connections accepted on a port across its replicas (layer 4),
+// e.g. to front databases. Replicas are tcp://host:port urls, or unix:///path urls of Unix domain sockets.
+type TCPService struct {
+	Name string `yaml:"name"`
+	// Address is the host or IP the service is bound to, all interfaces if unset
+	Address string `yaml:"address"`
+	// Port the connections are accepted on
+	Port     int        `yaml:"port"`
+	Replicas []*Replica `yaml:"replicas"`
+	// ConnectTimeout is how long connecting to a replica may take, defaults to 5s
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// IdleTimeout closes connections without traffic in either direction for that long, defaults to 1h
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// DrainTimeout is how long connections are given to finish on shutdown, or when their replica is
+	// removed by a reload, before they're closed. Defaults to 30s
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+	// ProxyProtocol accepts the PROXY protocol from the load balancers in front of the port
+	ProxyProtocol *ProxyProtocol `yaml:"proxy_protocol"`
+	// SendProxyProtocol starts the connections to the replicas with a PROXY protocol header of
+	// the given version, "v1" or "v2", carrying the address of the client. Not sent if unset
+	SendProxyProtocol string `yaml:"send_proxy_protocol"`
+}
+
+// ListenAddress returns the address the service listens on, as used by net.Listen
+func (s *TCPService) ListenAddress() string {
+	return net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+}
+
+// ConnectTimeoutOrDefault returns how long connecting to a replica may take
+func (s *TCPService) ConnectTimeoutOrDefault() time.Duration {
+	if s.ConnectTimeout == 0 {
+		return 5 * time.Second
+	}
+	return s.ConnectTimeout
+}
+
+// IdleTimeoutOrDefault returns the idle timeout of the connections
+func (s *TCPService) IdleTimeoutOrDefault() time.Duration {
+	if s.IdleTimeout == 0 {
+		return time.Hour
+	}
+	return s.IdleTimeout
+}
+
+// DrainTimeoutOrDefault returns how long connections are given to finish
+func (s *TCPService) DrainTimeoutOrDefault() time.Duration {
+	if s.DrainTimeout == 0 {
+		return 30 * time.Second
+	}
+	return s.DrainTimeout
+}
+
+// UDPService balances the datagrams received on a port across its replicas, keeping a session per client address
+// so that the replies of its replica are sent back to the client. Replicas are udp://host:port urls, and the replica
+// of a session is picked by hashing the client IP, so that a client keeps going to the same replica.
+type UDPService struct {
+	Name string `yaml:"name"`
+	// Address is the host or IP the service is bound to, all interfaces if unset
+	Address string `yaml:"address"`
+	// Port the datagrams are received on
+	Port     int        `yaml:"port"`
+	Replicas []*Replica `yaml:"replicas"`
+	// SessionTimeout expires the session of a client without datagrams in either direction for that long, defaults to 30s
+	SessionTimeout time.Duration `yaml:"session_timeout"`
+	// MaxSessions caps the sessions kept at once, each holding a socket to a replica. Datagrams of new clients are
+	// dropped while the cap is reached. Defaults to 1024
+	MaxSessions int `yaml:"max_sessions"`
+}
+
+// ListenAddress returns the address the service listens on, as used by net.ListenPacket
+func (s *UDPService) ListenAddress() string {
+	return net.JoinHostPort(s.Address, strconv.Itoa(s.Port))
+}
+
+// SessionTimeoutOrDefault returns how long sessions are kept without datagrams
+func (s *UDPService) SessionTimeoutOrDefault() time.Duration {
+	if s.SessionTimeout == 0 {
+		return 30 * time.Second
+	}
+	return s.SessionTimeout
+}
+
+// MaxSessionsOrDefault returns how many sessions may be kept at once
+func (s *UDPService) MaxSessionsOrDefault() int {
+	if s.MaxSessions == 0 {
+		return 1024
+	}
+	return s.MaxSessions
+}
+
+// validateTCPServices validates the TCP services, whose ports must not be used by the HTTP listeners
+// unless they're bound to different addresses
+func (c *Config) validateTCPServices(verr *ValidationError, listeners []Listener) {
+	seenNames := make(map[string]bool)
+	seenPorts := make(map[int]bool)
+	for i := range c.TCP {
+		service := &c.TCP[i]
+		name := service.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			verr.add("tcp service %s has no name", name)
+		} else if seenNames[name] {
+			verr.add("tcp service name %q is used more than once", name)
+		}
+		seenNames[name] = true
+
+		if service.Port < 1 || service.Port > 65535 {
+			verr.add("port %d of tcp service %s is out of range", service.Port, name)
+		} else if seenPorts[service.Port] || listensOnPortOf(listeners, service.Address, service.Port) {
+			verr.add("port %d of tcp service %s is already used", service.Port, name)
+		}
+		seenPorts[service.Port] = true
+
+		if service.ConnectTimeout < 0 || service.IdleTimeout < 0 || service.DrainTimeout < 0 {
+			verr.add("timeouts of tcp service %s must not be negative", name)
+		}
+		if service.ProxyProtocol != nil {
+			validateProxyProtocol(verr, "tcp service "+name, service.ProxyProtocol)
+		}
+		switch service.SendProxyProtocol {
+		case "", ProxyProtocolV1, ProxyProtocolV2:
+		default:
+			verr.add("unknown send_proxy_protocol %q of tcp service %s", service.SendProxyProtocol, name)
+		}
+
+		validateL4Replicas(verr, "tcp", name, service.Replicas)
+	}
+}
+
+// validateUDPServices validates the UDP services, whose ports may be used by TCP as well since they're another protocol
+func (c *Config) validateUDPServices(verr *ValidationError) {
+	seenNames := make(map[string]bool)
+	seenPorts := make(map[int]bool)
+	for i := range c.UDP {
+		service := &c.UDP[i]
+		name := service.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			verr.add("udp service %s has no name", name)
+		} else if seenNames[name] {
+			verr.add("udp service name %q is used more than once", name)
+		}
+		seenNames[name] = true
+
+		if service.Port < 1 || service.Port > 65535 {
+			verr.add("port %d of udp service %s is out of range", service.Port, name)
+		} else if seenPorts[service.Port] {
+			verr.add("port %d of udp service %s is already used", service.Port, name)
+		}
+		seenPorts[service.Port] = true
+
+		if service.SessionTimeout < 0 {
+			verr.add("session_timeout of udp service %s must not be negative", name)
+		}
+		if service.MaxSessions < 0 {
+			verr.add("max_sessions of udp service %s must not be negative", name)
+		}
+		validateL4Replicas(verr, "udp", name, service.Replicas)
+	}
+}
+
+// listensOnPortOf tells whether one of the listeners conflicts with a service bound to the given address and port
+func listensOnPortOf(listeners []Listener, address string, port int) bool {
+	service := &Listener{Address: address, Port: port}
+	for i := range listeners {
+		if listensOnSamePort(&listeners[i], service) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateL4Replicas validates the replicas of a service of the given network, which is the scheme of their urls
+func validateL4Replicas(verr *ValidationError, network, service string, replicas []*Replica) {
+	if len(replicas) == 0 {
+		verr.add("%s service %s has no replicas", network, service)
+	}
+	seenUrls := make(map[string]bool)
+	for _, replica := range replicas {
+		if replica == nil {
+			verr.add("%s service %s has an empty replica", network, service)
+			continue
+		}
+		if seenUrls[replica.Url] {
+			verr.add("replica %s is listed more than once in %s service %s", replica.Url, network, service)
+		}
+		seenUrls[replica.Url] = true
+
+		u, err := url.Parse(replica.Url)
+		if err != nil {
+			verr.add("replica url %q of %s service %s is invalid: %s", replica.Url, network, service, err)
+			continue
+		}
+		switch {
+		case network == "tcp" && isUnixReplica(u):
+			validateUnixReplica(verr, "tcp service "+service, u)
+		case u.Scheme != network:
+			verr.add("replica url %q of %s service %s must use %s", replica.Url, network, service, network)
+		case u.Hostname() == "" || u.Port() == "":
+			verr.add("replica url %q of %s service %s must have a host and a port", replica.Url, network, service)
+		}
+		validateWeight(verr, service, replica)
+	}
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Listener is an address or a Unix domain socket Mizan listens on, with its own settings
+type Listener struct {
+	// Address is the host or IP the listener is bound to, all interfaces if unset
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"`
+	// Network is "tcp4" or "tcp6" to listen on IPv4 or IPv6 only, both if unset
+	Network string `yaml:"network"`
+	// Socket listens on a Unix domain socket rather than on a port
+	Socket *UnixSocket `yaml:"socket"`
+	// TLS terminates TLS on the listener, it serves plain HTTP if unset
+	TLS *TLS `yaml:"tls"`
+	// Protocol restricts the protocol served to clients, "http1" for HTTP/1.1 only, or "h2c" for cleartext HTTP/2
+	// on a listener without TLS. HTTP/2 is offered along HTTP/1.1 on TLS listeners if unset.
+	Protocol string `yaml:"protocol"`
+	// H2C serves cleartext HTTP/2 on a listener without TLS, to clients with prior knowledge or upgrading from HTTP/1.1.
+	// Same as protocol "h2c"
+	H2C bool `yaml:"h2c"`
+	// ProxyProtocol accepts the PROXY protocol from the load balancers in front of the listener
+	ProxyProtocol *ProxyProtocol `yaml:"proxy_protocol"`
+	// Timeouts of the connections of the clients
+	Timeouts ListenerTimeouts `yaml:"timeouts"`
+	// Services are the names of the services exposed on the listener, all of them if unset.
+	// Requests to the other services are answered with 404.
+	Services []string `yaml:"services"`
+}
+
+// ListenerTimeouts are the timeouts of the connections of the clients of a listener, guarding against slow clients
+type ListenerTimeouts struct {
+	// Read is how long reading a whole request may take, defaults to 5s
+	Read time.Duration `yaml:"read"`
+	// ReadHeader is how long reading the headers of a request may take, defaults to the read timeout
+	ReadHeader time.Duration `yaml:"read_header"`
+	// Write is how long writing a response may take, from the end of the headers of the request. Defaults to 5s
+	Write time.Duration `yaml:"write"`
+	// Idle is how long a kept-alive connection may wait for the next request, defaults to 120s
+	Idle time.Duration `yaml:"idle"`
+}
+
+// ReadOrDefault returns how long reading a request may take
+func (t *ListenerTimeouts) ReadOrDefault() time.Duration {
+	if t.Read == 0 {
+		return 5 * time.Second
+	}
+	return t.Read
+}
+
+// WriteOrDefault returns how long writing a response may take
+func (t *ListenerTimeouts) WriteOrDefault() time.Duration {
+	if t.Write == 0 {
+		return 5 * time.Second
+	}
+	return t.Write
+}
+
+// IdleOrDefault returns how long a kept-alive connection may wait for the next request
+func (t *ListenerTimeouts) IdleOrDefault() time.Duration {
+	if t.Idle == 0 {
+		return 120 * time.Second
+	}
+	return t.Idle
+}
+
+// Name describes the listener, by its socket, its address or its port
+func (l *Listener) Name() string {
+	if l.Socket != nil {
+		return "socket " + l.Socket.Path
+	}
+	if l.Address != "" {
+		return "address " + net.JoinHostPort(l.Address, strconv.Itoa(l.Port))
+	}
+	return fmt.Sprintf("port %d", l.Port)
+}
+
+// NetworkOrDefault returns the network the listener listens on, as used by net.Listen
+func (l *Listener) NetworkOrDefault() string {
+	if l.Socket != nil {
+		return "unix"
+	}
+	if l.Network == "" {
+		return "tcp"
+	}
+	return l.Network
+}
+
+// ListenAddress returns the address the listener listens on, as used by net.Listen
+func (l *Listener) ListenAddress() string {
+	if l.Socket != nil {
+		return l.Socket.Path
+	}
+	return net.JoinHostPort(l.Address, strconv.Itoa(l.Port))
+}
+
+// ServesH2C tells whether the listener serves cleartext HTTP/2
+func (l *Listener) ServesH2C() bool {
+	return l.H2C || l.Protocol == H2C
+}
+
+// Exposes tells whether a service is exposed on the listener
+func (l *Listener) Exposes(service string) bool {
+	if len(l.Services) == 0 {
+		return true
+	}
+	for _, name := range l.Services {
+		if name == service {
+			return true
+		}
+	}
+	return false
+}
+
+// AllListeners returns the listeners, the ports included as plain HTTP listeners on all interfaces
+func (c *Config) AllListeners() []Listener {
+	listeners := make([]Listener, 0, len(c.Ports)+len(c.Listeners))
+	for _, port := range c.Ports {
+		listeners = append(listeners, Listener{Port: port})
+	}
+	return append(listeners, c.Listeners...)
+}
+
+func validateListener(verr *ValidationError, listener *Listener) {
+	if listener.Socket != nil {
+		validateUnixSocket(verr, listener)
+	} else {
+		if listener.Port < 1 || listener.Port > 65535 {
+			verr.add("port %d is out of range", listener.Port)
+		}
+		if listener.Network != "" && listener.Network != "tcp4" && listener.Network != "tcp6" {
+			verr.add("unknown network %q of listener on %s, it must be tcp4 or tcp6", listener.Network, listener.Name())
+		}
+	}
+
+	switch listener.Protocol {
+	case "", HTTP1:
+	case H2:
+		if listener.TLS == nil {
+			verr.add("listener on %s has protocol h2 without TLS, cleartext HTTP/2 is h2c", listener.Name())
+		}
+	case H2C:
+		if listener.TLS != nil {
+			verr.add("listener on %s has TLS, h2c is only for listeners without TLS", listener.Name())
+		}
+	default:
+		verr.add("unknown protocol %q of listener on %s", listener.Protocol, listener.Name())
+	}
+	if listener.TLS != nil {
+		validateTLS(verr, "listener on "+listener.Name(), listener.TLS)
+		if listener.H2C {
+			verr.add("listener on %s has TLS, h2c is only for listeners without TLS", listener.Name())
+		}
+		if listener.Protocol == HTTP1 && containsString(listener.TLS.ALPN, H2) {
+			verr.add("listener on %s has protocol http1 but offers h2 in its ALPN", listener.Name())
+		}
+	}
+	if listener.ProxyProtocol != nil {
+		validateProxyProtocol(verr, "listener on "+listener.Name(), listener.ProxyProtocol)
+	}
+	t := listener.Timeouts
+	if t.Read < 0 || t.ReadHeader < 0 || t.Write < 0 || t.Idle < 0 {
+		verr.add("timeouts of listener on %s must not be negative", listener.Name())
+	}
+}
+
+// listensOnSamePort tells whether two listeners on the same port conflict, which they do unless
+// they're bound to different addresses
+func listensOnSamePort(a, b *Listener) bool {
+	if a.Socket != nil || b.Socket != nil || a.Port != b.Port {
+		return false
+	}
+	return a.Address == "" || b.Address == "" || a.Address == b.Address ||
+		net.ParseIP(a.Address).IsUnspecified() || net.ParseIP(b.Address).IsUnspecified()
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
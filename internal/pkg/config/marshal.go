@@ -0,0 +1,47 @@
+package config
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Marshal encodes the config into canonical YAML, which can be loaded back with Parse.
+// Included files are flattened into the services, and secret values are replaced by the references
+// they were expanded from, so that the output doesn't leak them and they're resolved again when loaded.
+func (c *Config) Marshal() ([]byte, error) {
+	flat := *c
+	flat.Include = nil
+
+	root := &yaml.Node{}
+	if err := root.Encode(&flat); err != nil {
+		return nil, err
+	}
+	c.unexpandNode(root)
+	return yaml.Marshal(root)
+}
+
+func (c *Config) unexpandNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") && len(c.secrets) == 0 {
+			return
+		}
+		// Literal ${ must not be expanded when loaded back
+		value := escapeReferences(node.Value)
+		for secret, ref := range c.secrets {
+			value = strings.ReplaceAll(value, escapeReferences(secret), ref)
+		}
+		if value != node.Value {
+			node.Value = value
+			node.Tag = "!!str"
+		}
+		return
+	}
+	for _, child := range node.Content {
+		c.unexpandNode(child)
+	}
+}
+
+func escapeReferences(s string) string {
+	return strings.ReplaceAll(s, "${", "$${")
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("s3cr3t"), 0600))
+
+	conf := loadFromString(t, `
+max_connections: 1024
+services:
+  - matcher: "/api/v1"
+    name: "literal $${NOT_EXPANDED}"
+    replicas:
+      - url: "http://localhost:9090"
+        metadata:
+          token: "Bearer ${file:`+tokenPath+`}"
+`)
+	data, err := conf.Marshal()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t")
+	assert.Contains(t, string(data), "${file:"+tokenPath+"}")
+
+	loaded, err := Parse(data, YAML)
+	require.NoError(t, err)
+	require.NoError(t, loaded.Validate())
+	assert.Equal(t, "literal ${NOT_EXPANDED}", loaded.Services[0].Name)
+	assert.Equal(t, "Bearer s3cr3t", loaded.Services[0].Replicas[0].MetaData["token"])
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Priority assigns priority classes to the requests, so that the requests of the lowest priorities are shed first
+// when Mizan or a service is overloaded
+type Priority struct {
+	// Classes are the priority classes from the highest priority to the lowest, a single "default" class if unset
+	Classes []PriorityClass `yaml:"classes"`
+	// Default is the class of the requests that aren't given one, defaults to the lowest
+	Default string `yaml:"default"`
+	// Header is the header requests can give their class with, overriding the class of their service. Not read if unset
+	Header string `yaml:"header"`
+	// TrustedCIDRs are the networks of the clients whose header is read, e.g. of the internal services,
+	// so that other clients can't raise their priority. The header isn't read from any client if unset
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
+}
+
+// PriorityClass is a class of requests shed together
+type PriorityClass struct {
+	Name string `yaml:"name"`
+	// Capacity is the percentage of max_connections and of the concurrency limits of the services the requests
+	// of the class can use, defaults to 100
+	Capacity *float64 `yaml:"capacity"`
+}
+
+// String describes the class, with its capacity rather than the address of its capacity
+func (c PriorityClass) String() string {
+	return fmt.Sprintf("{Name:%s Capacity:%g}", c.Name, c.CapacityOrDefault())
+}
+
+var defaultPriorityClasses = []PriorityClass{{Name: "default"}}
+
+// ClassesOrDefault returns the priority classes from the highest priority to the lowest
+func (p *Priority) ClassesOrDefault() []PriorityClass {
+	if len(p.Classes) == 0 {
+		return defaultPriorityClasses
+	}
+	return p.Classes
+}
+
+// DefaultOrDefault returns the class of the requests that aren't given one
+func (p *Priority) DefaultOrDefault() string {
+	if p.Default == "" {
+		classes := p.ClassesOrDefault()
+		return classes[len(classes)-1].Name
+	}
+	return p.Default
+}
+
+// HeaderOrDefault returns the header requests can give their class with, empty if it's not read
+func (p *Priority) HeaderOrDefault() string {
+	return http.CanonicalHeaderKey(p.Header)
+}
+
+// TrustedNets returns the parsed trusted CIDRs, skipping the invalid ones which are reported by Validate
+func (p *Priority) TrustedNets() []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(p.TrustedCIDRs))
+	for _, cidr := range p.TrustedCIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, network)
+		}
+	}
+	return nets
+}
+
+// Trusts tells whether the header of a client, given by its address, is read
+func (p *Priority) Trusts(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// e.g. a client of a Unix domain socket listener
+		return false
+	}
+	for _, network := range p.TrustedNets() {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Level returns the level of a class, 0 being the highest priority, and whether the class exists
+func (p *Priority) Level(class string) (int, bool) {
+	for i, c := range p.ClassesOrDefault() {
+		if c.Name == class {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// CapacityOrDefault returns the percentage of the capacity the requests of the class can use
+func (c *PriorityClass) CapacityOrDefault() float64 {
+	if c.Capacity == nil {
+		return 100
+	}
+	return *c.Capacity
+}
+
+func validatePriority(verr *ValidationError, c *Config) {
+	names := make(map[string]bool)
+	for _, class := range c.Priority.Classes {
+		if class.Name == "" {
+			verr.add("priority classes must have a name")
+		} else if names[class.Name] {
+			verr.add("duplicate priority class %q", class.Name)
+		}
+		names[class.Name] = true
+		// A class without capacity would be shed even when Mizan is idle
+		if class.Capacity != nil && (*class.Capacity <= 0 || *class.Capacity > 100) {
+			verr.add("capacity of priority class %q must be greater than 0 and at most 100", class.Name)
+		}
+	}
+	for _, cidr := range c.Priority.TrustedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			verr.add("trusted cidr %q of priority is invalid", cidr)
+		}
+	}
+	if _, ok := c.Priority.Level(c.Priority.DefaultOrDefault()); !ok {
+		verr.add("unknown default priority class %q", c.Priority.Default)
+	}
+	for _, service := range c.Services {
+		if service.Priority == "" {
+			continue
+		}
+		if _, ok := c.Priority.Level(service.Priority); !ok {
+			verr.add("unknown priority class %q of service %s", service.Priority, service.Name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority_Trusts(t *testing.T) {
+	priority := &Priority{Header: "X-Priority"}
+	assert.False(t, priority.Trusts("203.0.113.7:1234"), "no client is trusted without trusted_cidrs")
+	assert.False(t, priority.Trusts("127.0.0.1:1234"), "no client is trusted without trusted_cidrs")
+
+	priority.TrustedCIDRs = []string{"10.0.0.0/8", "fd00::/8"}
+	assert.True(t, priority.Trusts("10.1.2.3:1234"))
+	assert.True(t, priority.Trusts("[fd00::1]:1234"))
+	assert.False(t, priority.Trusts("203.0.113.7:1234"))
+	assert.False(t, priority.Trusts("@"), "clients without an IP aren't trusted")
+}
+
+func TestPriority_Capacity(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+priority:
+  classes:
+    - name: "critical"
+    - name: "batch"
+      capacity: 50
+services:
+  - matcher: "/api"
+    name: "api"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	assert.Equal(t, float64(100), conf.Priority.Classes[0].CapacityOrDefault())
+	assert.Equal(t, float64(50), conf.Priority.Classes[1].CapacityOrDefault())
+
+	// The capacities are compared rather than their addresses
+	reloaded := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+priority:
+  classes:
+    - name: "critical"
+    - name: "batch"
+      capacity: 50
+services:
+  - matcher: "/api"
+    name: "api"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	assert.Empty(t, Diff(conf, reloaded))
+}
@@ -0,0 +1,34 @@
+package config
+
+import "strings"
+
+// Protocols spoken to the replicas of a service
+const (
+	// HTTP/1.1, over TLS for https replicas
+	HTTP1 = "http1"
+	// HTTP/2 over TLS, for https replicas
+	H2 = "h2"
+	// Cleartext HTTP/2 with prior knowledge, for http replicas
+	H2C = "h2c"
+)
+
+func validateProtocol(verr *ValidationError, service *Service, name string) {
+	scheme := ""
+	switch service.Protocol {
+	case "", HTTP1:
+		return
+	case H2:
+		scheme = "https"
+	case H2C:
+		scheme = "http"
+	default:
+		verr.add("unknown protocol %q of service %s", service.Protocol, name)
+		return
+	}
+	for _, replica := range service.Replicas {
+		// h2c is spoken over Unix domain sockets as well
+		if replica != nil && !strings.HasPrefix(replica.Url, scheme+"://") && !(service.Protocol == H2C && strings.HasPrefix(replica.Url, "unix://")) {
+			verr.add("replica url %q of service %s must use %s with protocol %s", replica.Url, name, scheme, service.Protocol)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"net"
+	"time"
+)
+
+// Versions of the PROXY protocol sent to the replicas of a TCP service
+const (
+	// The human-readable header
+	ProxyProtocolV1 = "v1"
+	// The binary header
+	ProxyProtocolV2 = "v2"
+)
+
+// ProxyProtocol accepts the PROXY protocol (v1 or v2) on a listener, so that the address of the clients is the one
+// sent by a load balancer in front of Mizan rather than the one of the load balancer.
+type ProxyProtocol struct {
+	// TrustedCIDRs are the networks of the load balancers, only their connections are expected to start with
+	// a PROXY protocol header. The connections of other sources are taken as they are.
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
+	// HeaderTimeout is how long a trusted source may take to send the header, defaults to 5s
+	HeaderTimeout time.Duration `yaml:"header_timeout"`
+}
+
+// HeaderTimeoutOrDefault returns how long a trusted source may take to send the header
+func (p *ProxyProtocol) HeaderTimeoutOrDefault() time.Duration {
+	if p.HeaderTimeout == 0 {
+		return 5 * time.Second
+	}
+	return p.HeaderTimeout
+}
+
+// TrustedNets returns the parsed trusted CIDRs, skipping the invalid ones which are reported by Validate
+func (p *ProxyProtocol) TrustedNets() []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(p.TrustedCIDRs))
+	for _, cidr := range p.TrustedCIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, network)
+		}
+	}
+	return nets
+}
+
+func validateProxyProtocol(verr *ValidationError, owner string, p *ProxyProtocol) {
+	if len(p.TrustedCIDRs) == 0 {
+		verr.add("proxy_protocol of %s has no trusted_cidrs", owner)
+	}
+	for _, cidr := range p.TrustedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			verr.add("trusted cidr %q of %s is invalid", cidr, owner)
+		}
+	}
+	if p.HeaderTimeout < 0 {
+		verr.add("header_timeout of %s must not be negative", owner)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Algorithms of the rate limits
+const (
+	// Requests take tokens from a bucket refilled at the rate of the limit, allowing bursts up to its size
+	RateLimitTokenBucket = "token_bucket"
+	// Requests are counted over a window sliding over the period, weighting the previous period by its overlap
+	RateLimitSlidingWindow = "sliding_window"
+)
+
+// Keys the requests are rate limited by
+const (
+	// The address of the client, as sent in the PROXY protocol header if any
+	RateLimitKeyIP = "ip"
+	// A header of the request, e.g. an API key
+	RateLimitKeyHeader = "header"
+	// A claim of the JWT bearer token of the request
+	RateLimitKeyJWTClaim = "jwt_claim"
+)
+
+// RateLimit limits the requests to a service made with each value of a key, e.g. by each client or API key.
+// Requests over the limit are answered with 429.
+type RateLimit struct {
+	// Name identifies the limit within its service, so that its state is kept across reloads however the limits
+	// are ordered. Defaults to a description of the limit, whose state is then reset when the limit is changed.
+	Name string `yaml:"name"`
+	// Algorithm is one of "token_bucket" and "sliding_window", defaults to token_bucket
+	Algorithm string `yaml:"algorithm"`
+	// Requests allowed per period
+	Requests int `yaml:"requests"`
+	// Period defaults to 1s
+	Period time.Duration `yaml:"period"`
+	// Burst is the size of the token bucket, defaults to the requests allowed per period
+	Burst int `yaml:"burst"`
+	// Key is what the requests are limited by
+	Key RateLimitKey `yaml:"key"`
+}
+
+// RateLimitKey is what the requests are rate limited by. Requests lacking the header or the claim are limited by
+// their client address.
+type RateLimitKey struct {
+	// Source is one of "ip", "header" and "jwt_claim", defaults to ip
+	Source string `yaml:"source"`
+	// Header is the header of the key, or of the JWT for jwt_claim which defaults to Authorization
+	Header string `yaml:"header"`
+	// Claim is the claim of the JWT, e.g. "sub". The JWT isn't verified, so limits by claim are only meaningful
+	// behind a proxy that authenticates the requests, otherwise clients can make up a claim per request
+	Claim string `yaml:"claim"`
+}
+
+// NameOrDefault returns the name of the limit, e.g. "token_bucket 100/1s by header X-Api-Key"
+func (l *RateLimit) NameOrDefault() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	key := l.Key.SourceOrDefault()
+	switch key {
+	case RateLimitKeyHeader:
+		key += " " + l.Key.HeaderOrDefault()
+	case RateLimitKeyJWTClaim:
+		key += " " + l.Key.Claim
+	}
+	return fmt.Sprintf("%s %d/%s by %s", l.AlgorithmOrDefault(), l.Requests, l.PeriodOrDefault(), key)
+}
+
+// AlgorithmOrDefault returns the algorithm of the limit
+func (l *RateLimit) AlgorithmOrDefault() string {
+	if l.Algorithm == "" {
+		return RateLimitTokenBucket
+	}
+	return l.Algorithm
+}
+
+// PeriodOrDefault returns the period of the limit
+func (l *RateLimit) PeriodOrDefault() time.Duration {
+	if l.Period == 0 {
+		return time.Second
+	}
+	return l.Period
+}
+
+// BurstOrDefault returns the size of the token bucket
+func (l *RateLimit) BurstOrDefault() int {
+	if l.Burst == 0 {
+		return l.Requests
+	}
+	return l.Burst
+}
+
+// SourceOrDefault returns what the requests are limited by
+func (k *RateLimitKey) SourceOrDefault() string {
+	if k.Source == "" {
+		return RateLimitKeyIP
+	}
+	return k.Source
+}
+
+// HeaderOrDefault returns the header of the key
+func (k *RateLimitKey) HeaderOrDefault() string {
+	if k.Header == "" && k.Source == RateLimitKeyJWTClaim {
+		return "Authorization"
+	}
+	return http.CanonicalHeaderKey(k.Header)
+}
+
+func validateRateLimits(verr *ValidationError, service string, limits []RateLimit) {
+	seenNames := make(map[string]bool)
+	for i := range limits {
+		limit := &limits[i]
+		if name := limit.NameOrDefault(); seenNames[name] {
+			verr.add("rate limit name %q of service %s is used more than once", name, service)
+		} else {
+			seenNames[name] = true
+		}
+		if algorithm := limit.AlgorithmOrDefault(); algorithm != RateLimitTokenBucket && algorithm != RateLimitSlidingWindow {
+			verr.add("unknown rate limit algorithm %q of service %s, it must be token_bucket or sliding_window", algorithm, service)
+		}
+		if limit.Requests < 1 {
+			verr.add("rate limits of service %s must allow at least 1 request", service)
+		}
+		if limit.Period < 0 || limit.Burst < 0 {
+			verr.add("period and burst of the rate limits of service %s must not be negative", service)
+		}
+		switch limit.Key.SourceOrDefault() {
+		case RateLimitKeyIP:
+		case RateLimitKeyHeader:
+			if limit.Key.Header == "" {
+				verr.add("rate limits of service %s by header must set the header", service)
+			}
+		case RateLimitKeyJWTClaim:
+			if limit.Key.Claim == "" {
+				verr.add("rate limits of service %s by jwt_claim must set the claim", service)
+			}
+		default:
+			verr.add("unknown rate limit key %q of service %s, it must be one of ip, header and jwt_claim", limit.Key.Source, service)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Failures retried by a retry policy
+const (
+	// Connecting to the replica failed, the request never reached it
+	RetryConnectError = "connect_error"
+	// The connection to the replica was reset, or closed, before the response came
+	RetryReset = "reset"
+	// The response didn't come in time
+	RetryTimeout = "timeout"
+)
+
+// Retries retries the failed requests of a service on other replicas
+type Retries struct {
+	// Attempts is the number of retries after the first attempt
+	Attempts int `yaml:"attempts"`
+	// On lists the failures retried, among "connect_error", "reset" and "timeout". Defaults to ["connect_error"]
+	On []string `yaml:"on"`
+	// Statuses are the statuses of the responses retried, e.g. [502, 503]
+	Statuses []int `yaml:"statuses"`
+	// Methods are the methods of the requests retried, the idempotent ones if unset. Requests failing to connect
+	// are retried whatever their method, since they never reached the replica.
+	Methods []string `yaml:"methods"`
+	// Backoff is the time waited before each retry
+	Backoff Backoff `yaml:"backoff"`
+	// MaxBodyBytes is the size up to which request bodies are buffered to be replayed, requests with larger bodies
+	// aren't retried. Defaults to 64KiB
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// Backoff waits a random time up to an exponentially growing limit, base * 2^retry capped by max
+type Backoff struct {
+	// Base defaults to 25ms
+	Base time.Duration `yaml:"base"`
+	// Max defaults to 250ms
+	Max time.Duration `yaml:"max"`
+}
+
+// RetryBudget caps the retries of all services to a share of the requests, so that retries don't pile up
+// on replicas that are already failing
+type RetryBudget struct {
+	// Percent of the requests of the last 10s that may be retried, defaults to 20. Set to 0, only the retries
+	// of min_per_second are allowed
+	Percent *float64 `yaml:"percent"`
+	// MinPerSecond retries are allowed whatever the traffic, so that services with little traffic can retry. Defaults to 10.
+	// Set to 0 along with percent, no retries are allowed
+	MinPerSecond *int `yaml:"min_per_second"`
+}
+
+// String describes the budget, with its limits rather than their addresses
+func (b RetryBudget) String() string {
+	return fmt.Sprintf("{Percent:%g MinPerSecond:%d}", b.PercentOrDefault(), b.MinPerSecondOrDefault())
+}
+
+var idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}
+
+// OnOrDefault returns the failures retried
+func (r *Retries) OnOrDefault() []string {
+	if len(r.On) == 0 {
+		return []string{RetryConnectError}
+	}
+	return r.On
+}
+
+// MethodsOrDefault returns the methods of the requests retried
+func (r *Retries) MethodsOrDefault() []string {
+	if len(r.Methods) == 0 {
+		return idempotentMethods
+	}
+	return r.Methods
+}
+
+// MaxBodyBytesOrDefault returns the size up to which request bodies are buffered
+func (r *Retries) MaxBodyBytesOrDefault() int64 {
+	if r.MaxBodyBytes == 0 {
+		return 64 * 1024
+	}
+	return r.MaxBodyBytes
+}
+
+// BaseOrDefault returns the base of the backoff
+func (b *Backoff) BaseOrDefault() time.Duration {
+	if b.Base == 0 {
+		return 25 * time.Millisecond
+	}
+	return b.Base
+}
+
+// MaxOrDefault returns the cap of the backoff
+func (b *Backoff) MaxOrDefault() time.Duration {
+	if b.Max == 0 {
+		return 250 * time.Millisecond
+	}
+	return b.Max
+}
+
+// PercentOrDefault returns the percentage of the requests that may be retried
+func (b *RetryBudget) PercentOrDefault() float64 {
+	if b.Percent == nil {
+		return 20
+	}
+	return *b.Percent
+}
+
+// MinPerSecondOrDefault returns the retries allowed per second whatever the traffic
+func (b *RetryBudget) MinPerSecondOrDefault() int {
+	if b.MinPerSecond == nil {
+		return 10
+	}
+	return *b.MinPerSecond
+}
+
+func validateRetries(verr *ValidationError, service string, r *Retries) {
+	if r.Attempts < 1 {
+		verr.add("retries of service %s must have at least 1 attempt", service)
+	}
+	for _, on := range r.On {
+		if on != RetryConnectError && on != RetryReset && on != RetryTimeout {
+			verr.add("unknown retry condition %q of service %s, it must be one of connect_error, reset and timeout", on, service)
+		}
+	}
+	for _, status := range r.Statuses {
+		if status < 100 || status > 599 {
+			verr.add("retried status %d of service %s is invalid", status, service)
+		}
+	}
+	for _, method := range r.Methods {
+		if method == "" || strings.ToUpper(method) != method {
+			verr.add("retried method %q of service %s must be uppercase", method, service)
+		}
+	}
+	if r.Backoff.Base < 0 || r.Backoff.Max < 0 || r.MaxBodyBytes < 0 {
+		verr.add("backoff and max_body_bytes of the retries of service %s must not be negative", service)
+	}
+}
+
+func validateRetryBudget(verr *ValidationError, b *RetryBudget) {
+	if b.Percent != nil && (*b.Percent < 0 || *b.Percent > 100) {
+		verr.add("percent of the retry budget must be between 0 and 100")
+	}
+	if b.MinPerSecond != nil && *b.MinPerSecond < 0 {
+		verr.add("min_per_second of the retry budget must not be negative")
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBudget_Zero(t *testing.T) {
+	load := func(budget string) *Config {
+		return loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+`+budget+`
+services:
+  - matcher: "/api"
+    name: "api"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	}
+	defaults := load("")
+	assert.Equal(t, float64(20), defaults.RetryBudget.PercentOrDefault())
+	assert.Equal(t, 10, defaults.RetryBudget.MinPerSecondOrDefault())
+
+	// A budget allowing no retries
+	none := load(`
+retry_budget:
+  percent: 0
+  min_per_second: 0`)
+	require.NoError(t, none.Validate())
+	assert.Equal(t, float64(0), none.RetryBudget.PercentOrDefault())
+	assert.Equal(t, 0, none.RetryBudget.MinPerSecondOrDefault())
+
+	changes := Diff(defaults, none)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "{Percent:20 MinPerSecond:10}", changes[0].Old)
+	assert.Equal(t, "{Percent:0 MinPerSecond:0}", changes[0].New)
+	assert.Empty(t, Diff(none, load(`
+retry_budget:
+  percent: 0
+  min_per_second: 0`)), "the limits are compared rather than their addresses")
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// A reference to an environment variable or a file, see interpolator
+const referencePattern = `^.*\$\{[^}]+\}.*$`
+
+// A duration such as "1m30s", see time.ParseDuration
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// JSONSchema returns a JSON Schema describing the config files, for IDEs to validate and autocomplete them.
+// It's generated from the Config model, so it's always in sync with what LoadConfig accepts.
+func JSONSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Config{}))
+	schema["$schema"] = schemaDraft
+	schema["title"] = "Mizan config"
+	// Lets JSON config files point to the schema
+	schema["properties"].(map[string]interface{})["$schema"] = map[string]interface{}{"type": "string"}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return withReference(map[string]interface{}{"type": "string", "pattern": durationPattern})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			properties[name] = typeSchema(field.Type)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		}
+	case reflect.Map:
+		values := typeSchema(t.Elem())
+		// Map values such as metadata are free-form, `weight: 6` is decoded into a string
+		if t.Elem().Kind() == reflect.String {
+			values = map[string]interface{}{"type": []string{"string", "number", "boolean"}}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": values,
+		}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return withReference(map[string]interface{}{"type": "boolean"})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return withReference(map[string]interface{}{"type": "integer"})
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return withReference(map[string]interface{}{"type": "integer", "minimum": 0})
+	case reflect.Float32, reflect.Float64:
+		return withReference(map[string]interface{}{"type": "number"})
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// withReference allows non-string values to be set through a reference, e.g. `port: ${PORT}`
+func withReference(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"anyOf": []interface{}{
+			schema,
+			map[string]interface{}{"type": "string", "pattern": referencePattern},
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchema(t *testing.T) {
+	buf, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema struct {
+		Properties map[string]struct {
+			Type  string `json:"type"`
+			Items struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &schema))
+
+	assert.Contains(t, schema.Properties, "max_connections")
+	assert.Equal(t, "array", schema.Properties["services"].Type)
+	assert.Contains(t, schema.Properties["services"].Items.Properties, "matcher")
+	assert.Contains(t, schema.Properties["services"].Items.Properties, "replicas")
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type TLS struct {
+	// Certificates served by the listener, selected by the server name (SNI) sent by the client.
+	// The first certificate is served to clients that don't send a server name matching any certificate.
+	Certificates []Certificate `yaml:"certificates"`
+	// MinVersion is the minimum TLS version accepted, one of "1.0", "1.1", "1.2" or "1.3". Defaults to "1.2"
+	MinVersion string `yaml:"min_version"`
+	// CipherSuites are the names of the cipher suites enabled for TLS 1.2 and below, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	// Go's defaults are used if unset. TLS 1.3 cipher suites aren't configurable.
+	CipherSuites []string `yaml:"cipher_suites"`
+	// ALPN lists the application protocols offered to clients, in order of preference, e.g. ["h2", "http/1.1"]
+	ALPN []string `yaml:"alpn"`
+	// ClientAuth authenticates clients by their certificates (mTLS)
+	ClientAuth *ClientAuth `yaml:"client_auth"`
+}
+
+// Client authentication modes, from the most to the least strict
+const (
+	// The client must present a certificate signed by one of the CAs
+	RequireAndVerify = "require_and_verify"
+	// The client may present a certificate, which must be signed by one of the CAs if presented
+	VerifyIfGiven = "verify_if_given"
+	// The client must present a certificate, which isn't verified
+	Require = "require"
+	// The client may present a certificate, which isn't verified
+	Request = "request"
+)
+
+// ClientAuth authenticates clients by their certificates. It can be set on TLS listeners,
+// where it's enforced during the handshake, and on services, where it's enforced on each request.
+type ClientAuth struct {
+	// CAFile is the bundle of CAs client certificates are verified against, required by the verifying modes
+	CAFile string `yaml:"ca_file"`
+	// Mode is one of "require_and_verify" (the default), "verify_if_given", "require" and "request"
+	Mode string `yaml:"mode"`
+	// AllowedSubjects are patterns the subject of the client certificate must match, either its common name
+	// or its whole distinguished name. "*" matches any sequence of characters. Any subject is allowed if unset.
+	AllowedSubjects []string `yaml:"allowed_subjects"`
+	// AllowedSANs are patterns one of the DNS names, emails, URIs or IPs of the client certificate must match
+	AllowedSANs []string `yaml:"allowed_sans"`
+	// Headers forward the identity of the client to the backends
+	Headers ClientIdentityHeaders `yaml:"headers"`
+}
+
+// ClientIdentityHeaders are the names of the headers carrying the identity of the client to the backends.
+// A header is only set if it's named, and is always stripped from the requests of the clients.
+type ClientIdentityHeaders struct {
+	// Subject carries the distinguished name of the client certificate
+	Subject string `yaml:"subject"`
+	// SANs carries the comma-separated DNS names, emails, URIs and IPs of the client certificate
+	SANs string `yaml:"sans"`
+	// Fingerprint carries the hex SHA-256 fingerprint of the client certificate
+	Fingerprint string `yaml:"fingerprint"`
+	// Certificate carries the URL-encoded PEM of the client certificate
+	Certificate string `yaml:"certificate"`
+	// Verified carries "true" if the client certificate has been verified against a CA, "false" otherwise
+	Verified string `yaml:"verified"`
+}
+
+// Names returns the names of the headers that are set
+func (h ClientIdentityHeaders) Names() []string {
+	names := make([]string, 0)
+	for _, name := range []string{h.Subject, h.SANs, h.Fingerprint, h.Certificate, h.Verified} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ModeOrDefault returns the client authentication mode
+func (ca *ClientAuth) ModeOrDefault() string {
+	if ca.Mode == "" {
+		return RequireAndVerify
+	}
+	return ca.Mode
+}
+
+// Verifies tells whether client certificates are verified against the CAs
+func (ca *ClientAuth) Verifies() bool {
+	mode := ca.ModeOrDefault()
+	return mode == RequireAndVerify || mode == VerifyIfGiven
+}
+
+// UpstreamTLS configures the TLS connections to the https replicas of a service
+type UpstreamTLS struct {
+	// CAFile is the bundle of CAs the certificates of the replicas are verified against, the system roots if unset
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate presented to the replicas (mTLS)
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName overrides the server name sent to the replicas (SNI) and expected in their certificates,
+	// which is the host of their url by default
+	ServerName string `yaml:"server_name"`
+	// InsecureSkipVerify skips the verification of the certificates of the replicas, only meant for development
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+type Certificate struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Version returns the minimum TLS version
+func (t *TLS) Version() uint16 {
+	if version, ok := tlsVersions[t.MinVersion]; ok {
+		return version
+	}
+	return tls.VersionTLS12
+}
+
+// CipherSuiteIDs returns the ids of the configured cipher suites, nil if Go's defaults should be used
+func (t *TLS) CipherSuiteIDs() []uint16 {
+	if len(t.CipherSuites) == 0 {
+		return nil
+	}
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		if suite := cipherSuite(name); suite != nil {
+			ids = append(ids, suite.ID)
+		}
+	}
+	return ids
+}
+
+func cipherSuite(name string) *tls.CipherSuite {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if strings.EqualFold(suite.Name, name) {
+			return suite
+		}
+	}
+	return nil
+}
+
+func validateTLS(verr *ValidationError, owner string, t *TLS) {
+	if len(t.Certificates) == 0 {
+		verr.add("TLS of %s has no certificates", owner)
+	}
+	for _, cert := range t.Certificates {
+		if cert.CertFile == "" || cert.KeyFile == "" {
+			verr.add("certificates of %s must have a cert_file and a key_file", owner)
+			continue
+		}
+		if _, err := tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile); err != nil {
+			verr.add("certificate %s of %s can't be loaded: %s", cert.CertFile, owner, err)
+		}
+	}
+	if _, ok := tlsVersions[t.MinVersion]; t.MinVersion != "" && !ok {
+		verr.add("unknown TLS version %q in %s", t.MinVersion, owner)
+	}
+	for _, name := range t.CipherSuites {
+		if cipherSuite(name) == nil {
+			verr.add("unknown cipher suite %q in %s", name, owner)
+		}
+	}
+	if t.ClientAuth != nil {
+		validateClientAuth(verr, owner, t.ClientAuth)
+	}
+}
+
+func validateClientAuth(verr *ValidationError, owner string, ca *ClientAuth) {
+	switch ca.ModeOrDefault() {
+	case RequireAndVerify, VerifyIfGiven, Require, Request:
+	default:
+		verr.add("unknown client_auth mode %q in %s", ca.Mode, owner)
+	}
+	if ca.Verifies() && ca.CAFile == "" {
+		verr.add("client_auth of %s verifies certificates but has no ca_file", owner)
+	}
+	if ca.CAFile != "" {
+		if _, err := LoadCertPool(ca.CAFile); err != nil {
+			verr.add("ca_file of %s can't be loaded: %s", owner, err)
+		}
+	}
+}
+
+func validateUpstreamTLS(verr *ValidationError, service *Service, name string) {
+	u := service.UpstreamTLS
+	if (u.CertFile == "") != (u.KeyFile == "") {
+		verr.add("upstream_tls of service %s must have both a cert_file and a key_file, or neither", name)
+	} else if u.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(u.CertFile, u.KeyFile); err != nil {
+			verr.add("client certificate %s of service %s can't be loaded: %s", u.CertFile, name, err)
+		}
+	}
+	if u.CAFile != "" {
+		if _, err := LoadCertPool(u.CAFile); err != nil {
+			verr.add("ca_file of the upstream_tls of service %s can't be loaded: %s", name, err)
+		}
+	}
+	for _, replica := range service.Replicas {
+		if replica != nil && strings.HasPrefix(replica.Url, "https://") {
+			return
+		}
+	}
+	verr.add("service %s has upstream_tls but none of its replicas use https", name)
+}
+
+// LoadCertPool loads a bundle of PEM encoded CA certificates
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
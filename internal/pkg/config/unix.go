@@ -0,0 +1,57 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// UnixSocket is a Unix domain socket a listener accepts connections on, e.g. from local agents
+type UnixSocket struct {
+	// Path of the socket file, which is replaced if it exists and is removed on shutdown
+	Path string `yaml:"path"`
+	// Mode is the octal file mode of the socket, e.g. "0660". Defaults to "0660"
+	Mode string `yaml:"mode"`
+	// Owner is the name or id of the user owning the socket, Mizan's user if unset
+	Owner string `yaml:"owner"`
+	// Group is the name or id of the group owning the socket, Mizan's group if unset
+	Group string `yaml:"group"`
+}
+
+// ModeOrDefault returns the file mode of the socket
+func (s *UnixSocket) ModeOrDefault() os.FileMode {
+	mode, err := strconv.ParseUint(s.Mode, 8, 32)
+	if s.Mode == "" || err != nil {
+		return 0660
+	}
+	return os.FileMode(mode)
+}
+
+func validateUnixSocket(verr *ValidationError, listener *Listener) {
+	socket := listener.Socket
+	if socket.Path == "" {
+		verr.add("socket of a listener has no path")
+	}
+	if listener.Port != 0 {
+		verr.add("listener on %s has a port, it must have either a port or a socket", listener.Name())
+	}
+	if socket.Mode != "" {
+		if mode, err := strconv.ParseUint(socket.Mode, 8, 32); err != nil || mode > 0777 {
+			verr.add("mode %q of the socket %s must be octal permissions, e.g. \"0660\"", socket.Mode, socket.Path)
+		}
+	}
+	if listener.ProxyProtocol != nil {
+		verr.add("listener on %s has proxy_protocol, which is only accepted on ports", listener.Name())
+	}
+}
+
+// isUnixReplica tells whether a replica url is a Unix domain socket, unix:// followed by the absolute path of the socket
+func isUnixReplica(u *url.URL) bool {
+	return u.Scheme == "unix"
+}
+
+func validateUnixReplica(verr *ValidationError, service string, u *url.URL) {
+	if u.Host != "" || u.Path == "" {
+		verr.add("replica url %q of service %s must be unix:// followed by the absolute path of the socket", u.String(), service)
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Strategies supported by Mizan, keyed by their config name
+var strategies = map[string]bool{
+	"rr":  true,
+	"wrr": true,
+}
+
+// ValidationError holds every problem found while validating a config,
+// so that all of them can be reported at once instead of one per run.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config: %s", strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the config for problems that would make Mizan misbehave at runtime.
+// It returns a *ValidationError listing all the problems, or nil if the config is valid.
+func (c *Config) Validate() error {
+	verr := &ValidationError{}
+	verr.Problems = append(verr.Problems, c.problems...)
+
+	if c.Strategy != "" && !strategies[strings.ToLower(c.Strategy)] {
+		verr.add("unknown strategy %q", c.Strategy)
+	}
+
+	if c.MaxConnections == 0 {
+		verr.add("max_connections must be greater than 0")
+	}
+
+	seenSockets := make(map[string]bool)
+	listeners := c.AllListeners()
+	for i := range listeners {
+		listener := &listeners[i]
+		validateListener(verr, listener)
+		if listener.Socket != nil {
+			if seenSockets[listener.Socket.Path] {
+				verr.add("socket %s is listed more than once", listener.Socket.Path)
+			}
+			seenSockets[listener.Socket.Path] = true
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if listensOnSamePort(&listeners[j], listener) {
+				verr.add("port %d is listed more than once", listener.Port)
+				break
+			}
+		}
+	}
+
+	if c.Admin.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Address); err != nil {
+			verr.add("admin address %q is invalid: %s", c.Admin.Address, err)
+		}
+	}
+	if c.History.Limit < 0 {
+		verr.add("history limit must not be negative")
+	}
+	if c.Upgrades.IdleTimeout < 0 || c.Upgrades.DrainTimeout < 0 {
+		verr.add("upgrades timeouts must not be negative")
+	}
+	validateRetryBudget(verr, &c.RetryBudget)
+	validatePriority(verr, c)
+
+	if len(c.Services) == 0 && len(c.TCP) == 0 && len(c.UDP) == 0 {
+		verr.add("no services defined")
+	}
+	c.validateTCPServices(verr, listeners)
+	c.validateUDPServices(verr)
+
+	seenMatchers := make(map[string]*Service)
+	seenNames := make(map[string]*Service)
+	for i := range c.Services {
+		service := &c.Services[i]
+		name := service.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			verr.add("service %s has no name", name)
+		} else if first, ok := seenNames[name]; ok {
+			verr.add("service name %q is used more than once%s", name, conflictSources(first, service))
+		} else {
+			seenNames[name] = service
+		}
+
+		if service.Matcher == "" {
+			verr.add("service %s has no matcher", name)
+		} else if !strings.HasPrefix(service.Matcher, "/") {
+			verr.add("matcher %q of service %s must start with /", service.Matcher, name)
+		} else if first, ok := seenMatchers[service.Matcher]; ok {
+			verr.add("matcher %q is used by more than one service%s", service.Matcher, conflictSources(first, service))
+		} else {
+			seenMatchers[service.Matcher] = service
+		}
+
+		if service.ClientAuth != nil {
+			validateClientAuth(verr, "service "+name, service.ClientAuth)
+		}
+		if service.UpstreamTLS != nil {
+			validateUpstreamTLS(verr, service, name)
+		}
+		validateProtocol(verr, service, name)
+		if t := service.Timeouts; t.Connect < 0 || t.ResponseHeader < 0 || t.Total < 0 {
+			verr.add("timeouts of service %s must not be negative", name)
+		}
+		if service.Retries != nil {
+			validateRetries(verr, name, service.Retries)
+		}
+		if service.CircuitBreaker != nil {
+			validateCircuitBreaker(verr, name, service.CircuitBreaker)
+		}
+		validateRateLimits(verr, name, service.RateLimits)
+		if service.Concurrency != nil {
+			validateConcurrency(verr, name, service.Concurrency)
+		}
+
+		if len(service.Replicas) == 0 {
+			verr.add("service %s has no replicas", name)
+		}
+		seenUrls := make(map[string]bool)
+		for _, replica := range service.Replicas {
+			if replica == nil {
+				verr.add("service %s has an empty replica", name)
+				continue
+			}
+			validateReplica(verr, name, replica)
+			if seenUrls[replica.Url] {
+				verr.add("replica %s is listed more than once in service %s", replica.Url, name)
+			}
+			seenUrls[replica.Url] = true
+		}
+	}
+
+	for _, listener := range listeners {
+		for _, name := range listener.Services {
+			if _, ok := seenNames[name]; !ok {
+				verr.add("listener on %s exposes unknown service %q", listener.Name(), name)
+			}
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		for i, problem := range verr.Problems {
+			verr.Problems[i] = c.Redact(problem)
+		}
+		return verr
+	}
+	return nil
+}
+
+// conflictSources tells where two conflicting services were defined, when they come from different files
+func conflictSources(first, second *Service) string {
+	if first.source == second.source {
+		return ""
+	}
+	return fmt.Sprintf(" (defined in %s and %s)", first.source, second.source)
+}
+
+func validateReplica(verr *ValidationError, service string, replica *Replica) {
+	u, err := url.Parse(replica.Url)
+	if err != nil {
+		verr.add("replica url %q of service %s is invalid: %s", replica.Url, service, err)
+		return
+	}
+	if isUnixReplica(u) {
+		validateUnixReplica(verr, service, u)
+	} else {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			verr.add("replica url %q of service %s must use http, https or unix", replica.Url, service)
+		}
+		if u.Host == "" {
+			verr.add("replica url %q of service %s has no host", replica.Url, service)
+		}
+	}
+	validateWeight(verr, service, replica)
+}
+
+func validateWeight(verr *ValidationError, service string, replica *Replica) {
+	if weight, ok := replica.MetaData["weight"]; ok {
+		if w, err := strconv.Atoi(weight); err != nil || w < 1 {
+			verr.add("weight %q of replica %s in service %s must be a positive integer", weight, replica.Url, service)
+		}
+	}
+}
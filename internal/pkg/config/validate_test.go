@@ -0,0 +1,432 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadFromString writes the given content to a temporary file and loads it as a config
+func loadFromString(t *testing.T, content string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	conf, err := LoadConfig(path)
+	require.NoError(t, err)
+	return conf
+}
+
+func TestValidate_ValidConfig(t *testing.T) {
+	conf := loadFromString(t, `
+strategy: "wrr"
+max_connections: 1024
+ports:
+  - 8080
+services:
+  - matcher: "/api/v1"
+    name: "test service"
+    replicas:
+      - url: "http://localhost:9090"
+        metadata:
+          weight: 2
+      - url: "http://localhost:9091"
+`)
+	assert.NoError(t, conf.Validate())
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	conf := loadFromString(t, `
+strategy: "random"
+ports:
+  - 8080
+  - 8080
+  - 70000
+services:
+  - matcher: "api"
+    name: "a"
+    replicas:
+      - url: "localhost:9090"
+        metadata:
+          weight: 0
+  - matcher: "api"
+    name: "a"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		`unknown strategy "random"`,
+		"max_connections must be greater than 0",
+		"port 8080 is listed more than once",
+		"port 70000 is out of range",
+		`matcher "api" of service a must start with /`,
+		`replica url "localhost:9090" of service a must use http, https or unix`,
+		`replica url "localhost:9090" of service a has no host`,
+		`weight "0" of replica localhost:9090 in service a must be a positive integer`,
+		`service name "a" is used more than once`,
+		`matcher "api" of service a must start with /`,
+		"service a has no replicas",
+	}, verr.Problems)
+}
+
+func TestValidate_UpstreamTLS(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api"
+    name: "api"
+    upstream_tls:
+      cert_file: "client.crt"
+      ca_file: "missing-ca.crt"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	require.Len(t, verr.Problems, 3)
+	assert.Equal(t, "upstream_tls of service api must have both a cert_file and a key_file, or neither", verr.Problems[0])
+	assert.Contains(t, verr.Problems[1], "ca_file of the upstream_tls of service api can't be loaded")
+	assert.Equal(t, "service api has upstream_tls but none of its replicas use https", verr.Problems[2])
+}
+
+func TestValidate_ProxyProtocol(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+listeners:
+  - port: 8080
+    proxy_protocol:
+      trusted_cidrs: ["10.0.0.0/33"]
+tcp:
+  - name: "db"
+    port: 5432
+    proxy_protocol: {}
+    send_proxy_protocol: "v3"
+    replicas:
+      - url: "tcp://localhost:5433"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		`trusted cidr "10.0.0.0/33" of listener on port 8080 is invalid`,
+		"proxy_protocol of tcp service db has no trusted_cidrs",
+		`unknown send_proxy_protocol "v3" of tcp service db`,
+	}, verr.Problems)
+}
+
+func TestValidate_UnixSockets(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+listeners:
+  - socket:
+      path: "/run/mizan.sock"
+      mode: "0999"
+  - port: 8080
+    socket:
+      path: "/run/mizan.sock"
+services:
+  - matcher: "/api"
+    name: "api"
+    replicas:
+      - url: "unix:///run/api.sock"
+      - url: "unix://api.sock"
+tcp:
+  - name: "db"
+    port: 5432
+    replicas:
+      - url: "unix:///run/db.sock"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		`mode "0999" of the socket /run/mizan.sock must be octal permissions, e.g. "0660"`,
+		"listener on socket /run/mizan.sock has a port, it must have either a port or a socket",
+		"socket /run/mizan.sock is listed more than once",
+		`replica url "unix://api.sock" of service api must be unix:// followed by the absolute path of the socket`,
+	}, verr.Problems)
+}
+
+func TestValidate_Listeners(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+listeners:
+  - address: "127.0.0.1"
+    port: 9090
+  - address: "10.0.0.1"
+    port: 9090
+  - address: "0.0.0.0"
+    port: 8080
+  - port: 9091
+    network: "udp"
+    protocol: "h2"
+    services: ["api", "admin"]
+    timeouts:
+      idle: "-1s"
+services:
+  - matcher: "/api"
+    name: "api"
+    replicas:
+      - url: "http://localhost:9092"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		"port 8080 is listed more than once",
+		`unknown network "udp" of listener on port 9091, it must be tcp4 or tcp6`,
+		"listener on port 9091 has protocol h2 without TLS, cleartext HTTP/2 is h2c",
+		"timeouts of listener on port 9091 must not be negative",
+		`listener on port 9091 exposes unknown service "admin"`,
+	}, verr.Problems)
+}
+
+func TestValidate_L4Addresses(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+listeners:
+  - address: "10.0.0.1"
+    port: 5432
+tcp:
+  - name: "db"
+    address: "127.0.0.1"
+    port: 5432
+    replicas:
+      - url: "tcp://localhost:5433"
+  - name: "cache"
+    address: "127.0.0.1"
+    port: 8080
+    replicas:
+      - url: "tcp://localhost:6379"
+udp:
+  - name: "dns"
+    address: "127.0.0.1"
+    port: 5432
+    replicas:
+      - url: "udp://localhost:53"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	// The db service is bound to another address than the listener on its port
+	assert.ElementsMatch(t, []string{
+		"port 8080 of tcp service cache is already used",
+	}, verr.Problems)
+	assert.Equal(t, "127.0.0.1:5432", conf.TCP[0].ListenAddress())
+	assert.Equal(t, ":8080", (&TCPService{Port: 8080}).ListenAddress())
+}
+
+func TestValidate_Retries(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+retry_budget:
+  percent: 120
+services:
+  - matcher: "/api"
+    name: "api"
+    retries:
+      on: ["connect_error", "5xx"]
+      statuses: [503, 700]
+      methods: ["get"]
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		"percent of the retry budget must be between 0 and 100",
+		"retries of service api must have at least 1 attempt",
+		`unknown retry condition "5xx" of service api, it must be one of connect_error, reset and timeout`,
+		"retried status 700 of service api is invalid",
+		`retried method "get" of service api must be uppercase`,
+	}, verr.Problems)
+}
+
+func TestValidate_CircuitBreaker(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api"
+    name: "api"
+    circuit_breaker:
+      error_rate: 150
+      open_timeout: "-1s"
+      consecutive_failures: -1
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		"window and open_timeout of the circuit breaker of service api must not be negative",
+		"min_requests, consecutive_failures and half_open_successes of the circuit breaker of service api must not be negative",
+		"error_rate of the circuit breaker of service api must be between 0 and 100",
+	}, verr.Problems)
+}
+
+func TestValidate_RateLimits(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api"
+    name: "api"
+    rate_limits:
+      - requests: 10
+        algorithm: "leaky_bucket"
+      - requests: 0
+        period: "-1s"
+        key:
+          source: "header"
+      - requests: 10
+        key:
+          source: "jwt_claim"
+      - requests: 10
+        key:
+          source: "cookie"
+      - name: "per-key"
+        requests: 10
+        key:
+          source: "header"
+          header: "X-Api-Key"
+      - name: "per-key"
+        requests: 100
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		`unknown rate limit algorithm "leaky_bucket" of service api, it must be token_bucket or sliding_window`,
+		"rate limits of service api must allow at least 1 request",
+		"period and burst of the rate limits of service api must not be negative",
+		"rate limits of service api by header must set the header",
+		"rate limits of service api by jwt_claim must set the claim",
+		`unknown rate limit key "cookie" of service api, it must be one of ip, header and jwt_claim`,
+		`rate limit name "per-key" of service api is used more than once`,
+	}, verr.Problems)
+}
+
+func TestValidate_Concurrency(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api"
+    name: "api"
+    concurrency:
+      max_in_flight: -1
+      queue:
+        timeout: "-1s"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		"max_in_flight and max_in_flight_per_replica of service api must not be negative",
+		"size and timeout of the queue of service api must not be negative",
+	}, verr.Problems)
+}
+
+func TestValidate_AdaptiveConcurrency(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+services:
+  - matcher: "/api"
+    name: "api"
+    concurrency:
+      max_in_flight: 10
+      adaptive:
+        algorithm: "vegas"
+        initial_limit: 5
+        min_limit: 10
+        tolerance: 0.5
+        backoff_ratio: 1.5
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		"service api must set either max_in_flight or an adaptive concurrency limit",
+		`unknown adaptive concurrency algorithm "vegas" of service api, it must be gradient or aimd`,
+		"tolerance of the adaptive concurrency of service api must be at least 1",
+		"initial_limit of the adaptive concurrency of service api must be between min_limit and max_limit",
+		"backoff_ratio of the adaptive concurrency of service api must be between 0 and 1",
+	}, verr.Problems)
+}
+
+func TestValidate_Priority(t *testing.T) {
+	conf := loadFromString(t, `
+max_connections: 1024
+ports: [8080]
+priority:
+  default: "normal"
+  header: "X-Priority"
+  trusted_cidrs: ["10.0.0.0/8", "10.0.0.1"]
+  classes:
+    - name: "critical"
+    - name: "critical"
+    - name: "interactive"
+      capacity: 0
+    - name: "batch"
+      capacity: 120
+services:
+  - matcher: "/api"
+    name: "api"
+    priority: "urgent"
+    replicas:
+      - url: "http://localhost:9090"
+`)
+	err := conf.Validate()
+	require.Error(t, err)
+
+	verr, ok := err.(*ValidationError)
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{
+		`duplicate priority class "critical"`,
+		`capacity of priority class "interactive" must be greater than 0 and at most 100`,
+		`capacity of priority class "batch" must be greater than 0 and at most 100`,
+		`trusted cidr "10.0.0.1" of priority is invalid`,
+		`unknown default priority class "normal"`,
+		`unknown priority class "urgent" of service api`,
+	}, verr.Problems)
+}
@@ -1,7 +1,12 @@
 package health
 
 import (
+	"crypto/tls"
+	"errors"
 	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Mo-Fatah/mizan/internal/pkg/common"
@@ -16,6 +21,8 @@ var (
 	period = 10 * time.Second
 	// The timeout after which the health checker will consider a server unhealthy
 	timeout = 3 * time.Second
+	// How long the health checker waits for a UDP server to be reported unreachable
+	udpProbeTimeout = 500 * time.Millisecond
 )
 
 // HealthChecker is a struct that is responsible for checking the health of servers
@@ -27,6 +34,8 @@ type HealthChecker struct {
 	serviceName string
 	// shutdown channel is used to signal the health checker to stop checking the health of servers
 	shutdown chan struct{}
+	// checked tells whether the first round of checks is over
+	checked atomic.Bool
 }
 
 func NewHealthChecker(servers []*common.Server, serviceName string) *HealthChecker {
@@ -50,9 +59,18 @@ func (hc *HealthChecker) Start() {
 	log.Infof("Starting Health checker for service: %s", hc.serviceName)
 	// Initially checking the health of servers before starting the health checker ticker
 	// Golang doesn't support a ticker with an instant first tick. See: https://github.com/golang/go/issues/17601
+	var firstRound sync.WaitGroup
 	for _, server := range hc.servers {
-		go checkHealth(server)
+		firstRound.Add(1)
+		go func(server *common.Server) {
+			defer firstRound.Done()
+			checkHealth(server)
+		}(server)
 	}
+	go func() {
+		firstRound.Wait()
+		hc.checked.Store(true)
+	}()
 
 	ticker := time.NewTicker(period)
 	defer ticker.Stop()
@@ -73,15 +91,16 @@ outer:
 }
 
 func checkHealth(s *common.Server) {
-	_, err := net.DialTimeout("tcp", s.GetUrl().Host, timeout)
+	conn, err := dial(s)
 	if err != nil {
-		log.Errorf("Could not connect to server %s of service %s", s.GetUrl().String(), s.GetServiceName())
+		log.Errorf("Could not connect to server %s of service %s: %s", s.GetUrl().String(), s.GetServiceName(), err)
 		oldState := s.SetLiveness(false)
 		if oldState {
 			log.Errorf("Transitioned server %s to unhealthy", s.GetUrl().String())
 		}
 		return
 	}
+	conn.Close()
 
 	oldState := s.SetLiveness(true)
 	if !oldState {
@@ -89,6 +108,44 @@ func checkHealth(s *common.Server) {
 	}
 }
 
+// dial connects to a server, completing the TLS handshake with an https server
+// so that a server whose certificate can't be verified is unhealthy
+func dial(s *common.Server) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if s.GetUrl().Scheme == "udp" {
+		return dialUDP(dialer, s)
+	}
+	if s.GetUrl().Scheme == "https" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.GetTLSConfig()}
+		return tlsDialer.Dial("tcp", s.GetAddress())
+	}
+	return dialer.Dial(s.GetNetwork(), s.GetAddress())
+}
+
+// dialUDP probes a UDP server with an empty datagram. UDP has no handshake, a server is only known to be down
+// when its host answers with an ICMP port unreachable, which fails the next read. A server that doesn't answer is alive.
+func dialUDP(dialer *net.Dialer, s *common.Server) (net.Conn, error) {
+	conn, err := dialer.Dial("udp", s.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(udpProbeTimeout))
+	if _, err := conn.Read(make([]byte, 1)); errors.Is(err, syscall.ECONNREFUSED) {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Checked tells whether every server has been checked once, so that the alive ones are known to be
+func (hc *HealthChecker) Checked() bool {
+	return hc.checked.Load()
+}
+
 func (hc *HealthChecker) ShutDown() {
 	hc.shutdown <- struct{}{}
 	// Wait for the health checker to shutdown
@@ -0,0 +1,208 @@
+// Package history keeps track of the configs applied by Mizan, so that a bad config can be rolled back
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The number of snapshots kept when no limit is configured
+	defaultLimit = 20
+	snapshotExt  = ".json"
+)
+
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot is a config that has been applied by Mizan
+type Snapshot struct {
+	ID int `json:"id"`
+	// Hash is the SHA-256 of the config
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	// Source tells where the config came from, e.g. the config file or a rollback
+	Source string `json:"source"`
+	// Config is the canonical YAML of the config, with secrets replaced by their references
+	Config string `json:"config,omitempty"`
+}
+
+// ShortHash returns the first 12 characters of the hash, enough to tell snapshots apart
+func (s *Snapshot) ShortHash() string {
+	if len(s.Hash) < 12 {
+		return s.Hash
+	}
+	return s.Hash[:12]
+}
+
+// SnapshotInfo describes a snapshot in the admin API
+type SnapshotInfo struct {
+	Snapshot
+	// Live tells whether this is the snapshot of the config being served
+	Live bool `json:"live"`
+}
+
+// History is a bounded list of snapshots, oldest first.
+// Snapshots are kept in memory, and also on disk if a directory is set, so that they survive restarts.
+type History struct {
+	mu        *sync.Mutex
+	snapshots []*Snapshot
+	nextID    int
+	limit     int
+	dir       string
+}
+
+// New creates a history keeping up to limit snapshots, loading the snapshots already stored in dir if it's set
+func New(limit int, dir string) (*History, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	h := &History{
+		mu:        &sync.Mutex{},
+		snapshots: make([]*Snapshot, 0),
+		nextID:    1,
+		limit:     limit,
+		dir:       dir,
+	}
+	if dir == "" {
+		return h, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *History) load() error {
+	files, err := filepath.Glob(filepath.Join(h.dir, "*"+snapshotExt))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		snapshot := &Snapshot{}
+		if err := json.Unmarshal(buf, snapshot); err != nil {
+			log.Errorf("Skipping corrupted config snapshot %s: %s", file, err)
+			continue
+		}
+		h.snapshots = append(h.snapshots, snapshot)
+		if snapshot.ID >= h.nextID {
+			h.nextID = snapshot.ID + 1
+		}
+	}
+	sort.Slice(h.snapshots, func(i, j int) bool {
+		return h.snapshots[i].ID < h.snapshots[j].ID
+	})
+	h.trim()
+	return nil
+}
+
+// Record adds a snapshot of the given config to the history.
+// Nothing is recorded if the config is the same as the latest snapshot.
+func (h *History) Record(config []byte, source string) (*Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hash := sha256.Sum256(config)
+	snapshot := &Snapshot{
+		ID:        h.nextID,
+		Hash:      hex.EncodeToString(hash[:]),
+		Timestamp: time.Now().UTC(),
+		Source:    source,
+		Config:    string(config),
+	}
+	if latest := h.latest(); latest != nil && latest.Hash == snapshot.Hash {
+		return latest, nil
+	}
+
+	if h.dir != "" {
+		buf, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(h.path(snapshot.ID), buf, 0600); err != nil {
+			return nil, err
+		}
+	}
+	h.nextID++
+	h.snapshots = append(h.snapshots, snapshot)
+	h.trim()
+	return snapshot, nil
+}
+
+// trim drops the oldest snapshots beyond the limit
+func (h *History) trim() {
+	for len(h.snapshots) > h.limit {
+		if h.dir != "" {
+			if err := os.Remove(h.path(h.snapshots[0].ID)); err != nil && !os.IsNotExist(err) {
+				log.Errorf("Error while removing config snapshot %d: %s", h.snapshots[0].ID, err)
+			}
+		}
+		h.snapshots = h.snapshots[1:]
+	}
+}
+
+func (h *History) latest() *Snapshot {
+	if len(h.snapshots) == 0 {
+		return nil
+	}
+	return h.snapshots[len(h.snapshots)-1]
+}
+
+func (h *History) path(id int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%08d%s", id, snapshotExt))
+}
+
+// List returns the snapshots, oldest first, without their configs
+func (h *History) List() []Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snapshots := make([]Snapshot, 0, len(h.snapshots))
+	for _, snapshot := range h.snapshots {
+		s := *snapshot
+		s.Config = ""
+		snapshots = append(snapshots, s)
+	}
+	return snapshots
+}
+
+// Get returns a snapshot by its id, or by a prefix of its hash
+func (h *History) Get(ref string) (*Snapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, snapshot := range h.snapshots {
+		if fmt.Sprint(snapshot.ID) == ref {
+			return snapshot, nil
+		}
+	}
+	var found *Snapshot
+	for _, snapshot := range h.snapshots {
+		if len(ref) >= 4 && strings.HasPrefix(snapshot.Hash, ref) {
+			if found != nil && found.Hash != snapshot.Hash {
+				return nil, fmt.Errorf("hash prefix %s is ambiguous", ref)
+			}
+			found = snapshot
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
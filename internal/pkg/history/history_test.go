@@ -0,0 +1,60 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_Record(t *testing.T) {
+	h, err := New(2, "")
+	require.NoError(t, err)
+
+	first, err := h.Record([]byte("strategy: rr"), "config.yml")
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.ID)
+
+	// Recording the same config twice in a row is a no-op
+	again, err := h.Record([]byte("strategy: rr"), "SIGHUP")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	_, err = h.Record([]byte("strategy: wrr"), "config.yml")
+	require.NoError(t, err)
+	_, err = h.Record([]byte("strategy: rr"), "rollback to snapshot 1")
+	require.NoError(t, err)
+
+	// Only the last 2 snapshots are kept
+	snapshots := h.List()
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, 2, snapshots[0].ID)
+	assert.Equal(t, 3, snapshots[1].ID)
+	assert.Empty(t, snapshots[1].Config)
+
+	_, err = h.Get("1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	snapshot, err := h.Get(first.Hash[:8])
+	require.NoError(t, err)
+	assert.Equal(t, 3, snapshot.ID)
+	assert.Equal(t, "strategy: rr", snapshot.Config)
+}
+
+func TestHistory_OnDisk(t *testing.T) {
+	dir := t.TempDir()
+	h, err := New(10, dir)
+	require.NoError(t, err)
+	_, err = h.Record([]byte("strategy: rr"), "config.yml")
+	require.NoError(t, err)
+	_, err = h.Record([]byte("strategy: wrr"), "config.yml")
+	require.NoError(t, err)
+
+	// A new history, e.g. after a restart, picks up where the previous one left off
+	restarted, err := New(10, dir)
+	require.NoError(t, err)
+	assert.Equal(t, h.List(), restarted.List())
+
+	snapshot, err := restarted.Record([]byte("strategy: rr"), "config.yml")
+	require.NoError(t, err)
+	assert.Equal(t, 3, snapshot.ID)
+}
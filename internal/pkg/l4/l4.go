@@ -0,0 +1,84 @@
+// Package l4 proxies raw connections between clients and replicas (layer 4)
+package l4
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// Counters count the connections proxied to a replica and the bytes they carried
+type Counters struct {
+	// Active is the number of connections currently open, Total the number of connections ever opened
+	Active int64 `json:"active"`
+	Total  int64 `json:"total"`
+	// BytesIn are the bytes sent by the clients to the replica, BytesOut the ones sent back by the replica
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// Snapshot returns a copy of the counters that's safe to read
+func (c *Counters) Snapshot() Counters {
+	return Counters{
+		Active:   atomic.LoadInt64(&c.Active),
+		Total:    atomic.LoadInt64(&c.Total),
+		BytesIn:  atomic.LoadInt64(&c.BytesIn),
+		BytesOut: atomic.LoadInt64(&c.BytesOut),
+	}
+}
+
+// Splice copies the data between a client and a replica until both are done sending, or either fails.
+// A side done sending has its half of the other connection closed, so that the other side sees the end of the stream.
+// Both connections are closed once Splice returns.
+func Splice(client, replica net.Conn, counters *Counters) {
+	atomic.AddInt64(&counters.Active, 1)
+	atomic.AddInt64(&counters.Total, 1)
+	defer atomic.AddInt64(&counters.Active, -1)
+	defer client.Close()
+	defer replica.Close()
+
+	errc := make(chan error, 2)
+	go func() { errc <- copyHalf(replica, client, &counters.BytesIn) }()
+	go func() { errc <- copyHalf(client, replica, &counters.BytesOut) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			// Unblocks the other copy
+			return
+		}
+	}
+}
+
+// copyHalf copies from src to dst until src is done sending, then closes the writing half of dst
+func copyHalf(dst, src net.Conn, count *int64) error {
+	_, err := io.Copy(&countingWriter{w: dst, count: count}, src)
+	if err != nil {
+		return err
+	}
+	if closer, ok := unwrap(dst).(interface{ CloseWrite() error }); ok {
+		return closer.CloseWrite()
+	}
+	return errors.New("connection can't be half closed")
+}
+
+// unwrap returns the connection wrapped by another, if any
+func unwrap(conn net.Conn) net.Conn {
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return conn
+		}
+		conn = wrapper.NetConn()
+	}
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	atomic.AddInt64(cw.count, int64(n))
+	return n, err
+}
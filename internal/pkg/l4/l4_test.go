@@ -0,0 +1,50 @@
+package l4
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connPair returns both ends of a TCP connection
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	accepted, err := ln.Accept()
+	require.NoError(t, err)
+	return dialed, accepted
+}
+
+func TestSplice(t *testing.T) {
+	client, clientSide := connPair(t)
+	replicaSide, replica := connPair(t)
+	counters := &Counters{}
+	done := make(chan struct{})
+	go func() {
+		Splice(clientSide, replicaSide, counters)
+		close(done)
+	}()
+
+	// The replica answers once the client is done sending, which it only knows through the half close
+	go func() {
+		received, _ := io.ReadAll(replica)
+		replica.Write(append([]byte("echo: "), received...))
+		replica.Close()
+	}()
+	_, err := client.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, client.(*net.TCPConn).CloseWrite())
+	answer, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello", string(answer))
+
+	<-done
+	assert.Equal(t, Counters{Total: 1, BytesIn: 5, BytesOut: 11}, counters.Snapshot())
+}
@@ -0,0 +1,189 @@
+package l4
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The largest datagram UDP can carry
+const maxDatagramSize = 64 * 1024
+
+// ErrTooManySessions is returned for the datagrams of a new client while the sessions are capped
+var ErrTooManySessions = errors.New("too many udp sessions")
+
+// Upstream is the replica the datagrams of a session are sent to
+type Upstream struct {
+	// Name identifies the replica in logs
+	Name string
+	// Address is the host and port of the replica
+	Address  string
+	Counters *Counters
+}
+
+// UDPProxy proxies the datagrams received on a connection to replicas. It keeps a session per client address,
+// with its own connection to the replica the session has been assigned, so that the replies are sent back to the client.
+type UDPProxy struct {
+	conn *net.UDPConn
+	// pick assigns a replica to the session of a new client
+	pick func(client *net.UDPAddr) (*Upstream, error)
+	// sessionTimeout returns how long a session is kept without datagrams in either direction
+	sessionTimeout func() time.Duration
+	// maxSessions returns how many sessions may be kept at once
+	maxSessions func() int
+
+	mu       *sync.Mutex
+	sessions map[string]*udpSession
+}
+
+type udpSession struct {
+	client   *net.UDPAddr
+	upstream *Upstream
+	conn     *net.UDPConn
+	// lastActive is the unix nano time of the last datagram of the session, in either direction
+	lastActive int64
+}
+
+func NewUDPProxy(conn *net.UDPConn, pick func(*net.UDPAddr) (*Upstream, error), sessionTimeout func() time.Duration, maxSessions func() int) *UDPProxy {
+	return &UDPProxy{
+		conn:           conn,
+		pick:           pick,
+		sessionTimeout: sessionTimeout,
+		maxSessions:    maxSessions,
+		mu:             &sync.Mutex{},
+		sessions:       make(map[string]*udpSession),
+	}
+}
+
+// Serve proxies the datagrams until the connection is closed, which closes the sessions as well
+func (p *UDPProxy) Serve() error {
+	defer p.closeSessions()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		session, err := p.session(client)
+		if errors.Is(err, ErrTooManySessions) {
+			// Logged at debug level since a flood of new clients would flood the logs as well
+			log.Debugf("Dropping datagram from %s: %s", client, err)
+			continue
+		}
+		if err != nil {
+			log.Errorf("Dropping datagram from %s: %s", client, err)
+			continue
+		}
+		atomic.StoreInt64(&session.lastActive, time.Now().UnixNano())
+		if _, err := session.conn.Write(buf[:n]); err != nil {
+			log.Errorf("Could not send datagram to %s: %s", session.upstream.Name, err)
+			continue
+		}
+		atomic.AddInt64(&session.upstream.Counters.BytesIn, int64(n))
+	}
+}
+
+// Sessions returns the number of open sessions
+func (p *UDPProxy) Sessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+// session returns the session of a client, opening one if it has none and the sessions aren't capped.
+// Sessions are only opened by the Serve loop, the replica is dialed without holding the lock so that the
+// reply loops closing their sessions meanwhile aren't blocked.
+func (p *UDPProxy) session(client *net.UDPAddr) (*udpSession, error) {
+	key := client.String()
+	p.mu.Lock()
+	session, ok := p.sessions[key]
+	full := len(p.sessions) >= p.maxSessions()
+	p.mu.Unlock()
+	if ok {
+		return session, nil
+	}
+	if full {
+		return nil, ErrTooManySessions
+	}
+
+	upstream, err := p.pick(client)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveUDPAddr("udp", upstream.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session = &udpSession{client: client, upstream: upstream, conn: conn}
+	p.sessions[key] = session
+	atomic.AddInt64(&upstream.Counters.Active, 1)
+	atomic.AddInt64(&upstream.Counters.Total, 1)
+	go p.reply(session)
+	return session, nil
+}
+
+// reply sends the datagrams of the replica back to the client until the session expires
+func (p *UDPProxy) reply(session *udpSession) {
+	defer p.closeSession(session)
+	buf := make([]byte, maxDatagramSize)
+	for {
+		timeout := p.sessionTimeout()
+		session.conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := session.conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// The client may have sent datagrams since the deadline was set
+				idle := time.Since(time.Unix(0, atomic.LoadInt64(&session.lastActive)))
+				if idle < timeout {
+					continue
+				}
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// e.g. the replica is unreachable, the session is kept until it expires
+			continue
+		}
+		atomic.StoreInt64(&session.lastActive, time.Now().UnixNano())
+		if _, err := p.conn.WriteToUDP(buf[:n], session.client); err != nil {
+			log.Errorf("Could not send datagram to %s: %s", session.client, err)
+			continue
+		}
+		atomic.AddInt64(&session.upstream.Counters.BytesOut, int64(n))
+	}
+}
+
+func (p *UDPProxy) closeSession(session *udpSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions[session.client.String()] == session {
+		delete(p.sessions, session.client.String())
+	}
+	session.conn.Close()
+	atomic.AddInt64(&session.upstream.Counters.Active, -1)
+}
+
+func (p *UDPProxy) closeSessions() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, session := range p.sessions {
+		// Fails the read of the reply loop, which then removes the session
+		session.conn.Close()
+	}
+}
@@ -0,0 +1,67 @@
+package l4
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoReplica starts a UDP replica sending the datagrams it receives back
+func echoReplica(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return conn
+}
+
+func TestUDPProxy_MaxSessions(t *testing.T) {
+	replica := echoReplica(t)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	upstream := &Upstream{Name: "replica", Address: replica.LocalAddr().String(), Counters: &Counters{}}
+	pick := func(*net.UDPAddr) (*Upstream, error) { return upstream, nil }
+	proxy := NewUDPProxy(conn, pick, func() time.Duration { return time.Minute }, func() int { return 1 })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		proxy.Serve()
+	}()
+	defer func() {
+		conn.Close()
+		<-done
+	}()
+
+	send := func() error {
+		client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		_, err = client.Write([]byte("ping"))
+		require.NoError(t, err)
+		client.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		buf := make([]byte, 16)
+		n, err := client.Read(buf)
+		if err == nil {
+			assert.Equal(t, "ping", string(buf[:n]))
+		}
+		return err
+	}
+
+	require.NoError(t, send())
+	// The second client is refused a session while the first one is kept
+	assert.Error(t, send())
+	assert.Equal(t, 1, proxy.Sessions())
+	assert.Equal(t, int64(1), upstream.Counters.Total)
+}
@@ -0,0 +1,103 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Weights of the latest latency in the recent and long-term averages of the gradient algorithm
+const (
+	shortWeight = 0.1
+	longWeight  = 0.01
+	// smoothing is the weight of the new limit computed from each latency
+	smoothing = 0.2
+)
+
+// Adaptive adjusts the limit of a Limiter to the latency of the requests, growing it while the latency holds
+// and shrinking it as the latency grows, i.e. as requests start queueing up in the replicas
+type Adaptive struct {
+	mu       *sync.Mutex
+	name     string
+	limiter  *Limiter
+	settings config.AdaptiveConcurrency
+	limit    float64
+	// shortLatency and longLatency are the recent and long-term averages of the latency, in seconds
+	shortLatency float64
+	longLatency  float64
+}
+
+// NewAdaptive adjusts the limit of a limiter, which starts at the initial limit. name identifies it in the logs.
+func NewAdaptive(name string, limiter *Limiter, settings *config.AdaptiveConcurrency) *Adaptive {
+	a := &Adaptive{
+		mu:       &sync.Mutex{},
+		name:     name,
+		limiter:  limiter,
+		settings: *settings,
+		limit:    float64(settings.InitialLimitOrDefault()),
+	}
+	limiter.SetMax(settings.InitialLimitOrDefault())
+	return a
+}
+
+// Observe adjusts the limit to the latency of a request, until its response headers. A failed request
+// tells the replicas are overloaded with the aimd algorithm.
+func (a *Adaptive) Observe(latency time.Duration, failed bool) {
+	inFlight := a.limiter.InFlight()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old := int(a.limit)
+	if a.settings.AlgorithmOrDefault() == config.AdaptiveAIMD {
+		a.aimd(latency, failed, inFlight)
+	} else {
+		a.gradient(latency.Seconds(), inFlight)
+	}
+	a.limit = math.Max(float64(a.settings.MinLimitOrDefault()), math.Min(float64(a.settings.MaxLimitOrDefault()), a.limit))
+	if limit := int(a.limit); limit != old {
+		a.limiter.SetMax(limit)
+		log.Debugf("Concurrency limit of service %s changed from %d to %d", a.name, old, limit)
+	}
+}
+
+// Limit returns the current limit
+func (a *Adaptive) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.limit)
+}
+
+func (a *Adaptive) gradient(latency float64, inFlight int) {
+	if a.longLatency == 0 {
+		a.shortLatency, a.longLatency = latency, latency
+	}
+	a.shortLatency = a.shortLatency*(1-shortWeight) + latency*shortWeight
+	a.longLatency = a.longLatency*(1-longWeight) + latency*longWeight
+	// The long-term average catches up quickly when the latency went down, e.g. once a slow deploy is over
+	if a.longLatency > 2*a.shortLatency {
+		a.longLatency *= 0.95
+	}
+	// The limit isn't grown by requests far from using it
+	if float64(inFlight) < a.limit/2 {
+		return
+	}
+	gradient := 1.0
+	if a.shortLatency > 0 {
+		gradient = math.Max(0.5, math.Min(1, a.settings.ToleranceOrDefault()*a.longLatency/a.shortLatency))
+	}
+	// The square root of the limit lets some requests queue up in the replicas, to find out whether they could take more
+	limit := a.limit*gradient + math.Sqrt(a.limit)
+	a.limit = a.limit*(1-smoothing) + limit*smoothing
+}
+
+func (a *Adaptive) aimd(latency time.Duration, failed bool, inFlight int) {
+	if failed || latency > a.settings.LatencyThresholdOrDefault() {
+		a.limit *= a.settings.BackoffRatioOrDefault()
+		return
+	}
+	if float64(inFlight) >= a.limit/2 {
+		a.limit++
+	}
+}
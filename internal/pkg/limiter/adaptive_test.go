@@ -0,0 +1,67 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// saturated returns a limiter with as many requests in flight as its limit allows
+func saturated(max int) *Limiter {
+	l := NewLimiter(max, 0, time.Second)
+	l.inFlight = max
+	return l
+}
+
+func TestAdaptive_Gradient(t *testing.T) {
+	l := saturated(0)
+	a := NewAdaptive("test", l, &config.AdaptiveConcurrency{InitialLimit: 10, MaxLimit: 100})
+	assert.Equal(t, 10, l.Max())
+
+	// The limit grows while the latency holds
+	for i := 0; i < 100; i++ {
+		l.inFlight = l.Max()
+		a.Observe(10*time.Millisecond, false)
+	}
+	grown := a.Limit()
+	assert.Greater(t, grown, 20)
+	assert.Equal(t, grown, l.Max())
+
+	// And shrinks as the latency grows
+	for i := 0; i < 50; i++ {
+		l.inFlight = l.Max()
+		a.Observe(100*time.Millisecond, false)
+	}
+	assert.Less(t, a.Limit(), grown/2)
+	assert.GreaterOrEqual(t, a.Limit(), 1)
+}
+
+func TestAdaptive_GradientIdle(t *testing.T) {
+	l := saturated(0)
+	a := NewAdaptive("test", l, &config.AdaptiveConcurrency{InitialLimit: 10})
+	l.inFlight = 1
+	for i := 0; i < 100; i++ {
+		a.Observe(10*time.Millisecond, false)
+	}
+	assert.Equal(t, 10, a.Limit(), "requests far from using the limit don't grow it")
+}
+
+func TestAdaptive_AIMD(t *testing.T) {
+	l := saturated(0)
+	a := NewAdaptive("test", l, &config.AdaptiveConcurrency{
+		Algorithm:        config.AdaptiveAIMD,
+		InitialLimit:     10,
+		MinLimit:         5,
+		LatencyThreshold: 50 * time.Millisecond,
+		BackoffRatio:     0.5,
+	})
+	l.inFlight = 10
+	a.Observe(10*time.Millisecond, false)
+	assert.Equal(t, 11, a.Limit())
+	a.Observe(10*time.Millisecond, true)
+	assert.Equal(t, 5, a.Limit())
+	a.Observe(100*time.Millisecond, false)
+	assert.Equal(t, 5, a.Limit(), "the limit doesn't go below min_limit")
+}
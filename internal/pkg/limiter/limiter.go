@@ -0,0 +1,209 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBusy is returned by the reserve function of Acquire when the request has to wait for room, e.g. on a replica
+	ErrBusy = errors.New("no room for the request")
+	// ErrQueueFull is returned when a request over the limits can't wait since the queue is full
+	ErrQueueFull = errors.New("queue is full")
+	// ErrQueueTimeout is returned when a request waited in the queue for too long
+	ErrQueueTimeout = errors.New("timed out in the queue")
+	// ErrShed is returned when a request waiting in the queue is evicted by a request of a higher priority
+	ErrShed = errors.New("evicted from the queue by a request of a higher priority")
+)
+
+// Priority is the priority of a request in a limiter
+type Priority struct {
+	// Level orders the requests, 0 being the highest priority
+	Level int
+	// Share is the fraction of the limit the request can use, so that lower priorities are shed first
+	Share float64
+}
+
+// Highest is the priority of the requests when priorities aren't used
+var Highest = Priority{Level: 0, Share: 1}
+
+// Limiter limits the requests in flight to a service, the requests over the limit waiting in a bounded queue
+// ordered by priority
+type Limiter struct {
+	mu *sync.Mutex
+	// max is the number of requests in flight, no limit if 0
+	max          int
+	inFlight     int
+	queueSize    int
+	queueTimeout time.Duration
+	// waiters are woken up in order as requests are released, by priority then by arrival
+	waiters []*waiter
+}
+
+type waiter struct {
+	level int
+	wake  chan struct{}
+	// shed tells the waiter was evicted rather than woken up
+	shed bool
+}
+
+func NewLimiter(max, queueSize int, queueTimeout time.Duration) *Limiter {
+	return &Limiter{
+		mu:           &sync.Mutex{},
+		max:          max,
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire takes room for a request, then calls reserve to take what else it needs, e.g. a replica with room.
+// The request waits in the queue if the limit is reached or reserve returns ErrBusy, until it's released room by another request.
+// A full queue evicts its lowest priority request for a request of a higher priority.
+// Other errors of reserve are returned right away. A request that acquired room must release it with Release.
+func (l *Limiter) Acquire(ctx context.Context, priority Priority, reserve func() error) error {
+	var deadline <-chan time.Time
+	for woken := false; ; woken = true {
+		l.mu.Lock()
+		if l.max == 0 || float64(l.inFlight) < float64(l.max)*priority.Share {
+			err := reserve()
+			if err == nil {
+				l.inFlight++
+				l.mu.Unlock()
+				return nil
+			}
+			if !errors.Is(err, ErrBusy) {
+				l.mu.Unlock()
+				return err
+			}
+		}
+		if !woken && len(l.waiters) >= l.queueSize && !l.evict(priority.Level) {
+			l.mu.Unlock()
+			return ErrQueueFull
+		}
+		// The deadline is set once, waking up doesn't give a request more time
+		if deadline == nil {
+			timer := time.NewTimer(l.queueTimeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		w := &waiter{level: priority.Level, wake: make(chan struct{})}
+		// A request woken up for nothing, e.g. beaten to the room by a new request, keeps its place
+		l.enqueue(w, woken)
+		l.mu.Unlock()
+
+		select {
+		case <-w.wake:
+			l.mu.Lock()
+			shed := w.shed
+			l.mu.Unlock()
+			if shed {
+				return ErrShed
+			}
+		case <-deadline:
+			l.leave(w)
+			return ErrQueueTimeout
+		case <-ctx.Done():
+			l.leave(w)
+			return ctx.Err()
+		}
+	}
+}
+
+// Release gives back the room of a request, waking up the waiting request of the highest priority
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+	l.wake()
+}
+
+// Notify wakes up the waiting request of the highest priority, e.g. once a replica has room
+func (l *Limiter) Notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.wake()
+}
+
+// InFlight returns the number of requests in flight
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Queued returns the number of requests waiting in the queue
+func (l *Limiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+// enqueue inserts a waiter after the waiters of its priority or a higher one, or before those of its priority if first
+func (l *Limiter) enqueue(w *waiter, first bool) {
+	i := 0
+	for i < len(l.waiters) && (l.waiters[i].level < w.level || (!first && l.waiters[i].level == w.level)) {
+		i++
+	}
+	l.waiters = append(l.waiters, nil)
+	copy(l.waiters[i+1:], l.waiters[i:])
+	l.waiters[i] = w
+}
+
+// evict sheds the last waiter if its priority is lower than the given level, and tells whether it did
+func (l *Limiter) evict(level int) bool {
+	if len(l.waiters) == 0 {
+		return false
+	}
+	last := l.waiters[len(l.waiters)-1]
+	if last.level <= level {
+		return false
+	}
+	l.waiters = l.waiters[:len(l.waiters)-1]
+	last.shed = true
+	close(last.wake)
+	return true
+}
+
+func (l *Limiter) wake() {
+	if len(l.waiters) == 0 {
+		return
+	}
+	close(l.waiters[0].wake)
+	l.waiters = l.waiters[1:]
+}
+
+// leave removes a request from the queue, passing its wake up on if it got one meanwhile
+func (l *Limiter) leave(w *waiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, waiter := range l.waiters {
+		if waiter == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return
+		}
+	}
+	if !w.shed {
+		l.wake()
+	}
+}
+
+// Max returns the number of requests in flight allowed, 0 for no limit
+func (l *Limiter) Max() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.max
+}
+
+// SetMax changes the number of requests in flight allowed, waking up as many waiting requests as there's new room for
+func (l *Limiter) SetMax(max int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.max = max
+	for room := l.max - l.inFlight; room > 0 && len(l.waiters) > 0; room-- {
+		l.wake()
+	}
+}
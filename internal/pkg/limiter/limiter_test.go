@@ -0,0 +1,132 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reserved() error { return nil }
+
+func TestLimiter_Queue(t *testing.T) {
+	l := NewLimiter(1, 1, time.Second)
+	require.NoError(t, l.Acquire(context.Background(), Highest, reserved))
+
+	acquired := make(chan error)
+	go func() { acquired <- l.Acquire(context.Background(), Highest, reserved) }()
+	for l.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.ErrorIs(t, l.Acquire(context.Background(), Highest, reserved), ErrQueueFull)
+
+	l.Release()
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, 1, l.InFlight())
+	assert.Equal(t, 0, l.Queued())
+}
+
+func TestLimiter_QueueTimeout(t *testing.T) {
+	l := NewLimiter(1, 1, 50*time.Millisecond)
+	require.NoError(t, l.Acquire(context.Background(), Highest, reserved))
+	start := time.Now()
+	assert.ErrorIs(t, l.Acquire(context.Background(), Highest, reserved), ErrQueueTimeout)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.Acquire(ctx, Highest, reserved), context.Canceled)
+	assert.Equal(t, 0, l.Queued())
+}
+
+func TestLimiter_Busy(t *testing.T) {
+	l := NewLimiter(0, 1, time.Second)
+	busy := true
+	acquired := make(chan error)
+	go func() {
+		acquired <- l.Acquire(context.Background(), Highest, func() error {
+			if busy {
+				return ErrBusy
+			}
+			return nil
+		})
+	}()
+	for l.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// A reserve failing otherwise isn't waited for
+	assert.EqualError(t, l.Acquire(context.Background(), Highest, func() error { return context.DeadlineExceeded }), context.DeadlineExceeded.Error())
+
+	// The waiting request tries again once notified
+	l.mu.Lock()
+	busy = false
+	l.mu.Unlock()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired before being notified: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.Notify()
+	assert.NoError(t, <-acquired)
+}
+
+func TestLimiter_SetMax(t *testing.T) {
+	l := NewLimiter(1, 2, time.Second)
+	l.inFlight = 1
+	acquired := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() { acquired <- l.Acquire(context.Background(), Highest, reserved) }()
+	}
+	for l.Queued() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	l.SetMax(3)
+	assert.NoError(t, <-acquired)
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, 3, l.InFlight())
+}
+
+func TestLimiter_Priorities(t *testing.T) {
+	l := NewLimiter(1, 2, time.Second)
+	require.NoError(t, l.Acquire(context.Background(), Highest, reserved))
+
+	acquired := make(chan string, 3)
+	acquire := func(name string, level int) {
+		if err := l.Acquire(context.Background(), Priority{Level: level, Share: 1}, reserved); err != nil {
+			acquired <- name + ": " + err.Error()
+			return
+		}
+		acquired <- name
+	}
+	go acquire("batch", 2)
+	for l.Queued() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	go acquire("default", 1)
+	for l.Queued() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A request of a higher priority evicts the lowest one from the full queue, and gets ahead of the others
+	go acquire("critical", 0)
+	// The request is queued as it evicts the other one
+	assert.Equal(t, "batch: "+ErrShed.Error(), <-acquired)
+	assert.ErrorIs(t, l.Acquire(context.Background(), Priority{Level: 2, Share: 1}, reserved), ErrQueueFull)
+
+	l.Release()
+	assert.Equal(t, "critical", <-acquired)
+	l.Release()
+	assert.Equal(t, "default", <-acquired)
+}
+
+func TestLimiter_Share(t *testing.T) {
+	l := NewLimiter(4, 0, time.Second)
+	batch := Priority{Level: 1, Share: 0.5}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, l.Acquire(context.Background(), batch, reserved))
+	}
+	assert.ErrorIs(t, l.Acquire(context.Background(), batch, reserved), ErrQueueFull, "batch requests can use half of the limit")
+	assert.NoError(t, l.Acquire(context.Background(), Highest, reserved))
+}
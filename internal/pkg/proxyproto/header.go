@@ -0,0 +1,196 @@
+// Package proxyproto reads and writes PROXY protocol headers (v1 and v2), which carry the addresses of the client
+// of a connection across a proxy, see https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// signature starts the binary headers of v2
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 headers are at most 107 bytes, including the CRLF
+const maxV1Length = 107
+
+// ErrNoHeader is returned when a connection doesn't start with a PROXY protocol header
+var ErrNoHeader = errors.New("no PROXY protocol header")
+
+// Header is a PROXY protocol header. Source is the address of the client, and Destination the address it connected to.
+// Both are nil when the addresses aren't known, e.g. the connection was opened by the proxy itself for a health check.
+type Header struct {
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// Read reads the header a connection starts with, in either version
+func Read(r *bufio.Reader) (*Header, error) {
+	prefix, err := r.Peek(5)
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) == "PROXY" {
+		return readV1(r)
+	}
+	prefix, err = r.Peek(len(signature))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoHeader
+		}
+		return nil, err
+	}
+	if bytes.Equal(prefix, signature) {
+		return readV2(r)
+	}
+	return nil, ErrNoHeader
+}
+
+// readV1 reads a header such as "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readV1(r *bufio.Reader) (*Header, error) {
+	line := make([]byte, 0, maxV1Length)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == maxV1Length {
+			return nil, errors.New("PROXY protocol v1 header is too long")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY protocol v1 header %q", line)
+	}
+	source, err := parseV1Address(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	destination, err := parseV1Address(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	if (source.IP.To4() != nil) != (fields[1] == "TCP4") || (destination.IP.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("addresses of PROXY protocol v1 header %q aren't %s", line, fields[1])
+	}
+	return &Header{Source: source, Destination: destination}, nil
+}
+
+func parseV1Address(ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("invalid address %q in PROXY protocol v1 header", ip)
+	}
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in PROXY protocol v1 header", port)
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+// readV2 reads a binary header, whose TLVs are skipped
+func readV2(r *bufio.Reader) (*Header, error) {
+	fixed := make([]byte, len(signature)+4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	versionCommand, family := fixed[12], fixed[13]
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if versionCommand>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", versionCommand>>4)
+	}
+	switch versionCommand & 0x0f {
+	case 0x0:
+		// LOCAL, the connection was opened by the proxy itself
+		return &Header{}, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY protocol v2 command %d", versionCommand&0x0f)
+	}
+
+	ipLength := 0
+	switch family {
+	case 0x11, 0x12:
+		// TCP or UDP over IPv4
+		ipLength = net.IPv4len
+	case 0x21, 0x22:
+		// TCP or UDP over IPv6
+		ipLength = net.IPv6len
+	default:
+		// Unspecified or unix sockets, whose addresses aren't kept
+		return &Header{}, nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return nil, errors.New("PROXY protocol v2 header is too short for its addresses")
+	}
+	return &Header{
+		Source: &net.TCPAddr{
+			IP:   net.IP(payload[:ipLength]),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLength:])),
+		},
+		Destination: &net.TCPAddr{
+			IP:   net.IP(payload[ipLength : 2*ipLength]),
+			Port: int(binary.BigEndian.Uint16(payload[2*ipLength+2:])),
+		},
+	}, nil
+}
+
+// Format formats the header in the given version, 1 or 2. The addresses are left out as unknown
+// when either is missing or they aren't of the same family.
+func (h *Header) Format(version int) ([]byte, error) {
+	var source, destination net.IP
+	if h.Source != nil && h.Destination != nil {
+		source, destination = h.Source.IP.To4(), h.Destination.IP.To4()
+		if source == nil || destination == nil {
+			source, destination = h.Source.IP.To16(), h.Destination.IP.To16()
+		}
+		if source == nil || destination == nil || len(source) != len(destination) {
+			source, destination = nil, nil
+		}
+	}
+
+	switch version {
+	case 1:
+		if source == nil {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		protocol := "TCP4"
+		if len(source) == net.IPv6len {
+			protocol = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", protocol, source, destination, h.Source.Port, h.Destination.Port)), nil
+	case 2:
+		header := append([]byte{}, signature...)
+		if source == nil {
+			// LOCAL with unspecified addresses
+			return append(header, 0x20, 0x00, 0x00, 0x00), nil
+		}
+		family := byte(0x11)
+		if len(source) == net.IPv6len {
+			family = 0x21
+		}
+		header = append(header, 0x21, family)
+		header = binary.BigEndian.AppendUint16(header, uint16(2*len(source)+4))
+		header = append(header, source...)
+		header = append(header, destination...)
+		header = binary.BigEndian.AppendUint16(header, uint16(h.Source.Port))
+		return binary.BigEndian.AppendUint16(header, uint16(h.Destination.Port)), nil
+	default:
+		return nil, fmt.Errorf("unknown PROXY protocol version %d", version)
+	}
+}
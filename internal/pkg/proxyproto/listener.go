@@ -0,0 +1,105 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Listener accepts connections that start with a PROXY protocol header when they come from trusted sources
+type Listener struct {
+	net.Listener
+	trusted []*net.IPNet
+	// headerTimeout is how long a trusted source may take to send the header
+	headerTimeout time.Duration
+}
+
+func NewListener(ln net.Listener, trusted []*net.IPNet, headerTimeout time.Duration) *Listener {
+	return &Listener{Listener: ln, trusted: trusted, headerTimeout: headerTimeout}
+}
+
+// Accept returns the next connection, whose header is only read once it's used so that slow sources don't hold up the others
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		trusted:       l.isTrusted(conn.RemoteAddr()),
+		headerTimeout: l.headerTimeout,
+	}, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection whose addresses are the ones of its PROXY protocol header, if it comes from a trusted source
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	trusted       bool
+	headerTimeout time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+}
+
+// Handshake reads the header of the connection if it's not been read yet, failing if a trusted source didn't send one
+func (c *Conn) Handshake() error {
+	c.once.Do(func() {
+		if !c.trusted {
+			return
+		}
+		c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		c.header, c.err = Read(c.reader)
+		if c.err != nil {
+			log.Errorf("Could not read the PROXY protocol header of %s: %s", c.Conn.RemoteAddr(), c.err)
+			c.Conn.Close()
+		}
+	})
+	return c.err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the address of the client sent in the header, or the address of the peer if there's none
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.Handshake() == nil && c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to sent in the header, or the local address if there's none
+func (c *Conn) LocalAddr() net.Addr {
+	if c.Handshake() == nil && c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
@@ -0,0 +1,131 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeader_FormatAndRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		header Header
+	}{
+		{"ipv4", Header{Source: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324}, Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 443}}},
+		{"ipv6", Header{Source: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}, Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}}},
+		{"unknown", Header{}},
+	}
+	for _, tt := range tests {
+		for _, version := range []int{1, 2} {
+			formatted, err := tt.header.Format(version)
+			require.NoError(t, err)
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(formatted), bytes.NewReader([]byte("GET / HTTP/1.1\r\n"))))
+			header, err := Read(r)
+			require.NoError(t, err, "%s v%d", tt.name, version)
+			if tt.header.Source == nil {
+				assert.Nil(t, header.Source)
+			} else {
+				assert.Equal(t, tt.header.Source.String(), header.Source.String(), "%s v%d", tt.name, version)
+				assert.Equal(t, tt.header.Destination.String(), header.Destination.String(), "%s v%d", tt.name, version)
+			}
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "GET / HTTP/1.1\r\n", string(rest), "the data after the header is kept")
+		}
+	}
+	assert.Equal(t, "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", formatV1(t, tests[0].header))
+}
+
+func formatV1(t *testing.T, header Header) string {
+	formatted, err := header.Format(1)
+	require.NoError(t, err)
+	return string(formatted)
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"no header", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{"short", "GET /\r\n"},
+		{"unknown protocol", "PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n"},
+		{"missing port", "PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"},
+		{"mismatched family", "PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n"},
+		{"too long", "PROXY TCP4 " + string(bytes.Repeat([]byte("1"), 120)) + "\r\n"},
+		{"truncated v2", string(signature) + "\x21\x11\x00\x0c\xc0\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bufio.NewReader(bytes.NewReader([]byte(tt.input))))
+			assert.Error(t, err)
+		})
+	}
+}
+
+// acceptWith accepts a connection on a listener trusting the given networks, over which the client sends data
+func acceptWith(t *testing.T, trusted []string, data string) *Conn {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, cidr := range trusted {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		nets = append(nets, network)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { inner.Close() })
+	ln := NewListener(inner, nets, 100*time.Millisecond)
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	_, err = client.Write([]byte(data))
+	require.NoError(t, err)
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn.(*Conn)
+}
+
+func TestListener(t *testing.T) {
+	header := "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+
+	t.Run("trusted source", func(t *testing.T) {
+		conn := acceptWith(t, []string{"127.0.0.0/8"}, header+"hello")
+		assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+		assert.Equal(t, "198.51.100.1:443", conn.LocalAddr().String())
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+	})
+
+	t.Run("untrusted source", func(t *testing.T) {
+		conn := acceptWith(t, []string{"10.0.0.0/8"}, header)
+		assert.Equal(t, conn.NetConn().RemoteAddr(), conn.RemoteAddr())
+		buf := make([]byte, len(header))
+		_, err := io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, header, string(buf), "the header isn't interpreted")
+	})
+
+	t.Run("trusted source without header", func(t *testing.T) {
+		conn := acceptWith(t, []string{"127.0.0.0/8"}, "GET / HTTP/1.1\r\n\r\n")
+		assert.ErrorIs(t, conn.Handshake(), ErrNoHeader)
+		_, err := conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+	})
+
+	t.Run("trusted source too slow to send the header", func(t *testing.T) {
+		conn := acceptWith(t, []string{"127.0.0.0/8"}, "PROXY TCP4")
+		assert.Error(t, conn.Handshake())
+	})
+}
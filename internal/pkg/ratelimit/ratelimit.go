@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// Limiter applies the rate limits of a service
+type Limiter struct {
+	service string
+	limits  []config.RateLimit
+}
+
+func NewLimiter(service string, limits []config.RateLimit) *Limiter {
+	return &Limiter{service: service, limits: limits}
+}
+
+// Allow takes a request from the limits of the service in turn, and returns the decision of the most restrictive one.
+// A request denied by a limit isn't taken from the following ones, and is given back to the previous ones,
+// so that it doesn't count against any of them. Limits the store fails to apply let the request through.
+func (l *Limiter) Allow(r *http.Request, store Store) Decision {
+	var result *Decision
+	taken := make([]takenFrom, 0, len(l.limits))
+	for i := range l.limits {
+		conf := &l.limits[i]
+		limit := Limit{
+			Algorithm: conf.AlgorithmOrDefault(),
+			Requests:  conf.Requests,
+			Period:    conf.PeriodOrDefault(),
+			Burst:     conf.BurstOrDefault(),
+		}
+		// Limits are told apart by their name, which is kept across reloads, and keys by their source
+		// since requests may fall back to their address
+		key := fmt.Sprintf("%s/%s/%s", l.service, conf.NameOrDefault(), keyOf(r, &conf.Key))
+		decision, err := store.Take(key, limit)
+		if err != nil {
+			log.Errorf("Could not apply rate limit %q of service %s: %s", conf.NameOrDefault(), l.service, err)
+			continue
+		}
+		if !decision.Allowed {
+			l.refund(store, taken)
+			return decision
+		}
+		taken = append(taken, takenFrom{conf: conf, key: key, limit: limit})
+		// The most restrictive of the limits allowing the request is the one with the fewest requests remaining
+		if result == nil || decision.Remaining < result.Remaining {
+			result = &decision
+		}
+	}
+	if result == nil {
+		return Decision{Allowed: true}
+	}
+	return *result
+}
+
+// takenFrom is a limit a request was taken from
+type takenFrom struct {
+	conf  *config.RateLimit
+	key   string
+	limit Limit
+}
+
+// refund gives a denied request back to the limits it was taken from
+func (l *Limiter) refund(store Store, taken []takenFrom) {
+	for _, t := range taken {
+		if err := store.Refund(t.key, t.limit); err != nil {
+			log.Errorf("Could not refund rate limit %q of service %s: %s", t.conf.NameOrDefault(), l.service, err)
+		}
+	}
+}
+
+// SetHeaders sets the RateLimit-* headers of a decision, and Retry-After if the request was denied
+func (d Decision) SetHeaders(h http.Header) {
+	if d.Limit == 0 {
+		return
+	}
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Max(1, float64(seconds(d.RetryAfter))))))
+	}
+}
+
+// seconds rounds a duration up to seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// keyOf returns the key a request is limited by, prefixed by its source
+func keyOf(r *http.Request, key *config.RateLimitKey) string {
+	switch key.SourceOrDefault() {
+	case config.RateLimitKeyHeader:
+		if value := r.Header.Get(key.HeaderOrDefault()); value != "" {
+			return "header:" + value
+		}
+	case config.RateLimitKeyJWTClaim:
+		if value, ok := jwtClaim(r.Header.Get(key.HeaderOrDefault()), key.Claim); ok {
+			return "claim:" + value
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// jwtClaim returns a claim of a JWT, optionally preceded by "Bearer ", without verifying it
+func jwtClaim(token, claim string) (string, bool) {
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", false
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	claims := make(map[string]interface{})
+	if err := decoder.Decode(&claims); err != nil {
+		return "", false
+	}
+	switch value := claims[claim].(type) {
+	case string:
+		return value, value != ""
+	case json.Number:
+		return value.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStore returns a store whose clock is moved by advancing the returned time
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	store, now := newTestStore()
+	limit := Limit{Algorithm: config.RateLimitTokenBucket, Requests: 2, Period: time.Second, Burst: 3}
+	for i := 0; i < 3; i++ {
+		decision, err := store.Take("key", limit)
+		assert.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		assert.Equal(t, 2-i, decision.Remaining)
+	}
+	decision, _ := store.Take("key", limit)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, decision.Reset)
+
+	decision, _ = store.Take("other", limit)
+	assert.True(t, decision.Allowed, "keys have their own buckets")
+
+	*now = now.Add(500 * time.Millisecond)
+	decision, _ = store.Take("key", limit)
+	assert.True(t, decision.Allowed)
+	decision, _ = store.Take("key", limit)
+	assert.False(t, decision.Allowed)
+}
+
+func TestMemoryStore_SlidingWindow(t *testing.T) {
+	store, now := newTestStore()
+	limit := Limit{Algorithm: config.RateLimitSlidingWindow, Requests: 4, Period: 10 * time.Second}
+	for i := 0; i < 4; i++ {
+		decision, _ := store.Take("key", limit)
+		assert.True(t, decision.Allowed)
+	}
+	decision, _ := store.Take("key", limit)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+	assert.Equal(t, 10*time.Second, decision.Reset)
+	assert.Equal(t, 10*time.Second, decision.RetryAfter, "the 4 requests must leave the window")
+
+	// Half the previous period is still in the window, counting for 2 requests
+	*now = now.Add(15 * time.Second)
+	for i := 0; i < 2; i++ {
+		decision, _ = store.Take("key", limit)
+		assert.True(t, decision.Allowed)
+	}
+	decision, _ = store.Take("key", limit)
+	assert.False(t, decision.Allowed)
+
+	// Stale entries are swept
+	*now = now.Add(2 * time.Minute)
+	store.Take("other", limit)
+	assert.Len(t, store.entries, 1)
+}
+
+func TestLimiter_Keys(t *testing.T) {
+	store, _ := newTestStore()
+	limiter := NewLimiter("api", []config.RateLimit{
+		{Requests: 1, Key: config.RateLimitKey{Source: config.RateLimitKeyHeader, Header: "x-api-key"}},
+		{Requests: 1, Key: config.RateLimitKey{Source: config.RateLimitKeyJWTClaim, Claim: "sub"}},
+	})
+	request := func(apiKey, sub string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Api-Key", apiKey)
+		if sub != "" {
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+			r.Header.Set("Authorization", "Bearer e30."+payload+".signature")
+		}
+		return r
+	}
+
+	assert.True(t, limiter.Allow(request("a", "alice"), store).Allowed)
+	assert.False(t, limiter.Allow(request("a", "bob"), store).Allowed, "limited by the API key")
+	assert.False(t, limiter.Allow(request("b", "alice"), store).Allowed, "limited by the claim")
+	assert.True(t, limiter.Allow(request("c", ""), store).Allowed, "limited by the address without a JWT")
+	assert.False(t, limiter.Allow(request("d", ""), store).Allowed)
+}
+
+func TestLimiter_DeniedRequestsAreNotTakenFurther(t *testing.T) {
+	store, _ := newTestStore()
+	perKey := config.RateLimit{Name: "per-key", Requests: 2, Key: config.RateLimitKey{Source: config.RateLimitKeyHeader, Header: "x-api-key"}}
+	limiter := NewLimiter("api", []config.RateLimit{{Requests: 1}, perKey})
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Api-Key", "a")
+		return r
+	}
+
+	assert.True(t, limiter.Allow(request(), store).Allowed)
+	assert.False(t, limiter.Allow(request(), store).Allowed, "limited by the address")
+	assert.False(t, limiter.Allow(request(), store).Allowed, "limited by the address")
+	// The denied requests didn't count against the limit by API key
+	decision := NewLimiter("api", []config.RateLimit{perKey}).Allow(request(), store)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+}
+
+func TestLimiter_DeniedRequestsAreRefunded(t *testing.T) {
+	store, _ := newTestStore()
+	byAddress := config.RateLimit{Requests: 5}
+	perKey := config.RateLimit{Name: "per-key", Requests: 1, Key: config.RateLimitKey{Source: config.RateLimitKeyHeader, Header: "x-api-key"}}
+	window := config.RateLimit{Name: "window", Algorithm: config.RateLimitSlidingWindow, Requests: 5}
+	limiter := NewLimiter("api", []config.RateLimit{byAddress, window, perKey})
+	request := func(apiKey string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Api-Key", apiKey)
+		return r
+	}
+
+	assert.True(t, limiter.Allow(request("a"), store).Allowed)
+	assert.False(t, limiter.Allow(request("a"), store).Allowed, "limited by the API key")
+	assert.False(t, limiter.Allow(request("a"), store).Allowed, "limited by the API key")
+	// The denied requests were given back to the limits by address
+	decision := NewLimiter("api", []config.RateLimit{byAddress}).Allow(request("b"), store)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 3, decision.Remaining)
+	decision = NewLimiter("api", []config.RateLimit{window}).Allow(request("b"), store)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 3, decision.Remaining)
+}
+
+func TestMemoryStore_Refund(t *testing.T) {
+	store, now := newTestStore()
+	bucket := Limit{Algorithm: config.RateLimitTokenBucket, Requests: 1, Period: time.Second, Burst: 1}
+	store.Take("bucket", bucket)
+	assert.NoError(t, store.Refund("bucket", bucket))
+	decision, _ := store.Take("bucket", bucket)
+	assert.True(t, decision.Allowed)
+	assert.NoError(t, store.Refund("unknown", bucket), "refunding an unknown key is a no-op")
+
+	window := Limit{Algorithm: config.RateLimitSlidingWindow, Requests: 2, Period: 10 * time.Second}
+	store.Take("window", window)
+	store.Take("window", window)
+	// The requests are still refunded once their period is over
+	*now = now.Add(10 * time.Second)
+	assert.NoError(t, store.Refund("window", window))
+	decision, _ = store.Take("window", window)
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 0, decision.Remaining)
+}
+
+func TestLimiter_StateKeptAcrossReorders(t *testing.T) {
+	store, _ := newTestStore()
+	byAddress := config.RateLimit{Requests: 1}
+	byKey := config.RateLimit{Name: "per-key", Requests: 5, Key: config.RateLimitKey{Source: config.RateLimitKeyHeader, Header: "x-api-key"}}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Api-Key", "a")
+
+	assert.True(t, NewLimiter("api", []config.RateLimit{byAddress, byKey}).Allow(r, store).Allowed)
+	// As after a reload reordering the limits
+	decision := NewLimiter("api", []config.RateLimit{byKey, byAddress}).Allow(r, store)
+	assert.False(t, decision.Allowed, "limited by the address")
+	assert.Equal(t, 1, decision.Limit)
+}
+
+func TestDecision_SetHeaders(t *testing.T) {
+	header := make(http.Header)
+	Decision{Limit: 10, Remaining: 0, Reset: 1500 * time.Millisecond, RetryAfter: 100 * time.Millisecond}.SetHeaders(header)
+	assert.Equal(t, "10", header.Get("RateLimit-Limit"))
+	assert.Equal(t, "0", header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", header.Get("RateLimit-Reset"))
+	assert.Equal(t, "1", header.Get("Retry-After"))
+
+	header = make(http.Header)
+	Decision{Allowed: true, Limit: 10, Remaining: 9}.SetHeaders(header)
+	assert.Empty(t, header.Get("Retry-After"))
+}
@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// Limit is a rate limit as applied by a store
+type Limit struct {
+	// Algorithm is config.RateLimitTokenBucket or config.RateLimitSlidingWindow
+	Algorithm string
+	// Requests allowed per period
+	Requests int
+	Period   time.Duration
+	// Burst is the size of the token bucket
+	Burst int
+}
+
+// Decision is the outcome of taking a request from a limit
+type Decision struct {
+	Allowed bool
+	// Limit is the number of requests the limit allows at once
+	Limit int
+	// Remaining is the number of requests still allowed
+	Remaining int
+	// Reset is how long it takes for the limit to allow all its requests again
+	Reset time.Duration
+	// RetryAfter is how long it takes for a denied request to be allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the state of the rate limits. The state can be shared by several Mizan instances
+// with a store backed by a shared database.
+type Store interface {
+	// Take takes a request from the limit of a key, and tells whether it's allowed
+	Take(key string, limit Limit) (Decision, error)
+	// Refund gives back a request taken from the limit of a key, which another limit denied
+	Refund(key string, limit Limit) error
+}
+
+// The stale entries of the memory store are removed at most this often
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the state of the rate limits in memory, for a single Mizan instance
+type MemoryStore struct {
+	mu        *sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type entry struct {
+	// tokens left in the bucket when last updated
+	tokens  float64
+	updated time.Time
+	// requests counted in the current and previous periods of the sliding window
+	windowStart time.Time
+	current     int
+	previous    int
+	// expires is when the entry is back to its initial state, and can be removed
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu:      &sync.Mutex{},
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{tokens: float64(limit.Burst), updated: now}
+		s.entries[key] = e
+	}
+	if limit.Algorithm == config.RateLimitSlidingWindow {
+		return e.slidingWindow(now, limit), nil
+	}
+	return e.tokenBucket(now, limit), nil
+}
+
+func (s *MemoryStore) Refund(key string, limit Limit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if limit.Algorithm == config.RateLimitSlidingWindow {
+		e.refundWindow()
+		return nil
+	}
+	e.tokens = math.Min(float64(limit.Burst), e.tokens+1)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (e *entry) tokenBucket(now time.Time, limit Limit) Decision {
+	// Tokens per nanosecond
+	rate := float64(limit.Requests) / float64(limit.Period)
+	burst := float64(limit.Burst)
+	e.tokens = math.Min(burst, e.tokens+float64(now.Sub(e.updated))*rate)
+	e.updated = now
+
+	decision := Decision{Limit: limit.Burst}
+	if e.tokens >= 1 {
+		e.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = time.Duration(math.Ceil((1 - e.tokens) / rate))
+	}
+	decision.Remaining = int(e.tokens)
+	decision.Reset = time.Duration(math.Ceil((burst - e.tokens) / rate))
+	e.expires = now.Add(decision.Reset)
+	return decision
+}
+
+func (e *entry) slidingWindow(now time.Time, limit Limit) Decision {
+	period := limit.Period
+	start := now.Truncate(period)
+	switch {
+	case start.Sub(e.windowStart) == period:
+		e.previous, e.current = e.current, 0
+	case !start.Equal(e.windowStart):
+		e.previous, e.current = 0, 0
+	}
+	e.windowStart = start
+
+	elapsed := now.Sub(start)
+	requests := float64(limit.Requests)
+	// The previous period counts for the part of it still in the window
+	estimated := float64(e.previous)*(1-float64(elapsed)/float64(period)) + float64(e.current)
+
+	decision := Decision{Limit: limit.Requests, Reset: period - elapsed}
+	if estimated < requests {
+		e.current++
+		estimated++
+		decision.Allowed = true
+	} else if float64(e.current) >= requests {
+		// Not before the next period, once enough of the current one has left the window
+		decision.RetryAfter = period - elapsed + time.Duration(float64(period)*(1-requests/float64(e.current)))
+	} else {
+		decision.RetryAfter = time.Duration(float64(period)*(1-(requests-float64(e.current))/float64(e.previous))) - elapsed
+	}
+	decision.Remaining = int(math.Max(0, requests-math.Ceil(estimated)))
+	e.expires = start.Add(2 * period)
+	return decision
+}
+
+// refundWindow uncounts a request from the current period, or from the previous one if another request
+// moved the window on since it was taken
+func (e *entry) refundWindow() {
+	if e.current > 0 {
+		e.current--
+	} else if e.previous > 0 {
+		e.previous--
+	}
+}
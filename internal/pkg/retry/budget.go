@@ -0,0 +1,83 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// The budget is computed over the requests and retries of the last window, counted per second
+const windowSeconds = 10
+
+// Budget caps the retries to a share of the requests, plus a minimum number of retries per second
+type Budget struct {
+	mu           *sync.Mutex
+	percent      float64
+	minPerSecond int
+	// buckets count the requests and retries of each second of the window, by unix second modulo the window
+	buckets [windowSeconds]bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	second   int64
+	requests int64
+	retries  int64
+}
+
+func NewBudget(percent float64, minPerSecond int) *Budget {
+	return &Budget{
+		mu:           &sync.Mutex{},
+		percent:      percent,
+		minPerSecond: minPerSecond,
+		now:          time.Now,
+	}
+}
+
+// SetLimits changes the limits of the budget, keeping the counts of the window
+func (b *Budget) SetLimits(percent float64, minPerSecond int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.percent = percent
+	b.minPerSecond = minPerSecond
+}
+
+// Request counts a request, which adds to the retries allowed
+func (b *Budget) Request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current().requests++
+}
+
+// TryRetry counts a retry if the budget allows it, and tells whether it does
+func (b *Budget) TryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.allows() {
+		return false
+	}
+	b.current().retries++
+	return true
+}
+
+func (b *Budget) allows() bool {
+	second := b.now().Unix()
+	var requests, retries int64
+	for _, counts := range b.buckets {
+		if second-counts.second < windowSeconds {
+			requests += counts.requests
+			retries += counts.retries
+		}
+	}
+	allowed := float64(requests)*b.percent/100 + float64(b.minPerSecond*windowSeconds)
+	return float64(retries) < allowed
+}
+
+// current returns the bucket of the current second, emptied if it's been left from a previous window
+func (b *Budget) current() *bucket {
+	second := b.now().Unix()
+	counts := &b.buckets[second%windowSeconds]
+	if counts.second != second {
+		*counts = bucket{second: second}
+	}
+	return counts
+}
@@ -0,0 +1,123 @@
+// Package retry decides which failed requests are retried, and when
+package retry
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/common"
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// Policy is the retry policy of a service
+type Policy struct {
+	attempts     int
+	on           map[string]bool
+	statuses     map[int]bool
+	methods      map[string]bool
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	maxBodyBytes int64
+}
+
+func NewPolicy(conf *config.Retries) *Policy {
+	p := &Policy{
+		attempts:     conf.Attempts,
+		on:           make(map[string]bool),
+		statuses:     make(map[int]bool),
+		methods:      make(map[string]bool),
+		backoffBase:  conf.Backoff.BaseOrDefault(),
+		backoffMax:   conf.Backoff.MaxOrDefault(),
+		maxBodyBytes: conf.MaxBodyBytesOrDefault(),
+	}
+	for _, on := range conf.OnOrDefault() {
+		p.on[on] = true
+	}
+	for _, status := range conf.Statuses {
+		p.statuses[status] = true
+	}
+	for _, method := range conf.MethodsOrDefault() {
+		p.methods[method] = true
+	}
+	return p
+}
+
+// Attempts returns the number of retries after the first attempt
+func (p *Policy) Attempts() int {
+	return p.attempts
+}
+
+// RetriesStatus tells whether a request answered with the given status is retried
+func (p *Policy) RetriesStatus(r *http.Request, status int) bool {
+	return p.methods[r.Method] && p.statuses[status]
+}
+
+// RetriesError tells whether a request that failed with the given error is retried
+func (p *Policy) RetriesError(r *http.Request, err error) bool {
+	switch {
+	case isConnectError(err):
+		// The request never reached the replica, it's safe to retry whatever its method
+		return p.on[config.RetryConnectError]
+	case common.IsTimeout(err):
+		return p.on[config.RetryTimeout] && p.methods[r.Method]
+	case isReset(err):
+		return p.on[config.RetryReset] && p.methods[r.Method]
+	default:
+		return false
+	}
+}
+
+// Backoff returns the time to wait before the given retry, starting at 1, a random time up to base * 2^(retry-1) capped by max
+func (p *Policy) Backoff(retry int) time.Duration {
+	limit := p.backoffMax
+	if retry < 32 {
+		if exp := p.backoffBase << (retry - 1); exp > 0 && exp < limit {
+			limit = exp
+		}
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// BufferBody buffers the body of a request so that it can be replayed by the returned function, which resets the body
+// of the request before each attempt. The body isn't replayable if it's larger than the limit of the policy, in which
+// case the request is left as if it hadn't been read.
+func (p *Policy) BufferBody(r *http.Request) (replay func(), ok bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return func() {}, true, nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, p.maxBodyBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(buf)) > p.maxBodyBytes {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false, nil
+	}
+	r.Body.Close()
+	replay = func() {
+		r.Body = io.NopCloser(bytes.NewReader(buf))
+	}
+	replay()
+	return replay, true, nil
+}
+
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Retries(t *testing.T) {
+	policy := NewPolicy(&config.Retries{
+		Attempts: 2,
+		On:       []string{config.RetryConnectError, config.RetryReset},
+		Statuses: []int{http.StatusServiceUnavailable},
+	})
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	post := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	assert.True(t, policy.RetriesStatus(get, http.StatusServiceUnavailable))
+	assert.False(t, policy.RetriesStatus(get, http.StatusInternalServerError))
+	assert.False(t, policy.RetriesStatus(post, http.StatusServiceUnavailable), "POST isn't idempotent")
+
+	_, connectErr := net.Dial("tcp", "127.0.0.1:1")
+	require.Error(t, connectErr)
+	assert.True(t, policy.RetriesError(get, connectErr))
+	assert.True(t, policy.RetriesError(post, connectErr), "the request never reached the replica")
+
+	reset := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+	assert.True(t, policy.RetriesError(get, reset))
+	assert.False(t, policy.RetriesError(post, reset))
+	assert.False(t, policy.RetriesError(get, &net.OpError{Op: "read", Err: timeoutError{}}), "timeouts aren't retried")
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPolicy_Backoff(t *testing.T) {
+	policy := NewPolicy(&config.Retries{Attempts: 5, Backoff: config.Backoff{Base: 10 * time.Millisecond, Max: 30 * time.Millisecond}})
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, policy.Backoff(1), 10*time.Millisecond)
+		assert.LessOrEqual(t, policy.Backoff(2), 20*time.Millisecond)
+		assert.LessOrEqual(t, policy.Backoff(5), 30*time.Millisecond)
+		assert.LessOrEqual(t, policy.Backoff(100), 30*time.Millisecond)
+	}
+}
+
+func TestPolicy_BufferBody(t *testing.T) {
+	policy := NewPolicy(&config.Retries{Attempts: 1, MaxBodyBytes: 8})
+
+	r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload"))
+	replay, ok, err := policy.BufferBody(r)
+	require.NoError(t, err)
+	require.True(t, ok)
+	for i := 0; i < 2; i++ {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "payload", string(body))
+		replay()
+	}
+
+	// Larger bodies aren't replayable, but are still sent whole
+	r = httptest.NewRequest(http.MethodPut, "/", bytes.NewReader([]byte("a larger payload")))
+	_, ok, err = policy.BufferBody(r)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "a larger payload", string(body))
+}
+
+func TestBudget(t *testing.T) {
+	now := time.Unix(1000, 0)
+	budget := NewBudget(10, 0)
+	budget.now = func() time.Time { return now }
+
+	assert.False(t, budget.TryRetry(), "no traffic, no retries")
+	for i := 0; i < 20; i++ {
+		budget.Request()
+	}
+	assert.True(t, budget.TryRetry())
+	assert.True(t, budget.TryRetry())
+	assert.False(t, budget.TryRetry(), "10% of 20 requests")
+
+	// The requests and retries leave the window after 10s
+	now = now.Add(10 * time.Second)
+	assert.False(t, budget.TryRetry())
+
+	budget.SetLimits(10, 1)
+	for i := 0; i < 10; i++ {
+		assert.True(t, budget.TryRetry(), "1 retry per second over the window")
+	}
+	assert.False(t, budget.TryRetry())
+}
@@ -0,0 +1,152 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoCertificates = errors.New("no certificates")
+
+	// Certificates are usually rotated by writing the certificate and the key one after the other.
+	// Changes are coalesced into one reload once no new change happened for this long.
+	reloadDebounce = 500 * time.Millisecond
+)
+
+// CertStore holds the certificates served by a TLS listener, and selects one for each handshake.
+// Certificates are reloaded when their files change, without affecting the connections being served.
+type CertStore struct {
+	mu    *sync.RWMutex
+	pairs []config.Certificate
+	// certs[i] is the certificate loaded from pairs[i]
+	certs []*tls.Certificate
+}
+
+func NewCertStore(pairs []config.Certificate) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, ErrNoCertificates
+	}
+	certs := make([]*tls.Certificate, 0, len(pairs))
+	for _, pair := range pairs {
+		cert, err := loadKeyPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return &CertStore{
+		mu:    &sync.RWMutex{},
+		pairs: pairs,
+		certs: certs,
+	}, nil
+}
+
+func loadKeyPair(pair config.Certificate) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	// The parsed leaf is needed to match the certificate against the server name
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// GetCertificate selects the first certificate matching the server name and the capabilities of the client,
+// falling back to the first certificate. It's meant to be used as tls.Config.GetCertificate.
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if hello.ServerName != "" {
+		for _, cert := range cs.certs {
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return cs.certs[0], nil
+}
+
+// Reload loads the certificates again, swapping in the ones that changed.
+// A pair that can't be loaded, e.g. because the key doesn't match the certificate yet, is skipped
+// and its previous certificate is kept in service.
+func (cs *CertStore) Reload() {
+	for i, pair := range cs.pairs {
+		cert, err := loadKeyPair(pair)
+		if err != nil {
+			log.Errorf("Rejecting certificate %s, keeping the current one: %s", pair.CertFile, err)
+			continue
+		}
+
+		cs.mu.Lock()
+		changed := !bytes.Equal(cs.certs[i].Certificate[0], cert.Certificate[0])
+		if changed {
+			cs.certs[i] = cert
+		}
+		cs.mu.Unlock()
+		if changed {
+			log.Infof("Reloaded certificate %s, valid until %s", pair.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// Watch reloads the certificates when their files change, until stop is closed.
+// The parent directories are watched, since certificates are often replaced through a rename or a symlink swap.
+func (cs *CertStore) Watch(stop <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Error while watching certificates: %s", err)
+		return
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool)
+	for _, pair := range cs.pairs {
+		for _, dir := range []string{filepath.Dir(pair.CertFile), filepath.Dir(pair.KeyFile)} {
+			if watched[dir] {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				log.Errorf("Error while watching certificates directory %s: %s", dir, err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// Unchanged certificates aren't swapped, so any change in the directories can trigger a reload
+			debounce.Reset(reloadDebounce)
+		case <-debounce.C:
+			cs.Reload()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Error while watching certificates: %s", err)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for the given DNS names and its key into dir
+func writeCert(t *testing.T, dir, name string, dnsNames ...string) config.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	pair := config.Certificate{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	require.NoError(t, os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return pair
+}
+
+func TestCertStore_SNI(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewCertStore([]config.Certificate{
+		writeCert(t, dir, "default", "example.com"),
+		writeCert(t, dir, "api", "api.example.org"),
+		writeCert(t, dir, "wildcard", "*.example.net"),
+	})
+	require.NoError(t, err)
+
+	for serverName, expected := range map[string]string{
+		"example.com":     "example.com",
+		"api.example.org": "api.example.org",
+		"www.example.net": "*.example.net",
+		"unknown.io":      "example.com",
+		"":                "example.com",
+	} {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedCurves:   []tls.CurveID{tls.CurveP256},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, cert.Leaf.DNSNames[0], serverName)
+	}
+}
+
+func TestCertStore_Reload(t *testing.T) {
+	dir := t.TempDir()
+	pair := writeCert(t, dir, "site", "example.com")
+	store, err := NewCertStore([]config.Certificate{pair})
+	require.NoError(t, err)
+	hello := &tls.ClientHelloInfo{ServerName: "example.com"}
+	original, _ := store.GetCertificate(hello)
+
+	// A certificate written without its key yet doesn't match the current key, the current certificate is kept
+	otherDir := t.TempDir()
+	rotated := writeCert(t, otherDir, "site", "example.com")
+	certPEM, err := os.ReadFile(rotated.CertFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(pair.CertFile, certPEM, 0644))
+	store.Reload()
+	current, _ := store.GetCertificate(hello)
+	assert.Same(t, original, current)
+
+	// Once the key is written as well, the new certificate is swapped in
+	keyPEM, err := os.ReadFile(rotated.KeyFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(pair.KeyFile, keyPEM, 0600))
+	store.Reload()
+	current, _ = store.GetCertificate(hello)
+	assert.NotSame(t, original, current)
+	assert.Equal(t, certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: current.Certificate[0]}))
+}
@@ -0,0 +1,165 @@
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+var (
+	ErrNoClientCertificate = errors.New("client certificate required")
+
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		config.RequireAndVerify: tls.RequireAndVerifyClientCert,
+		config.VerifyIfGiven:    tls.VerifyClientCertIfGiven,
+		config.Require:          tls.RequireAnyClientCert,
+		config.Request:          tls.RequestClientCert,
+	}
+)
+
+// ClientVerifier enforces client authentication settings on the certificates presented by clients
+type ClientVerifier struct {
+	auth     *config.ClientAuth
+	pool     *x509.CertPool
+	subjects []*regexp.Regexp
+	sans     []*regexp.Regexp
+}
+
+func NewClientVerifier(auth *config.ClientAuth) (*ClientVerifier, error) {
+	v := &ClientVerifier{
+		auth:     auth,
+		subjects: compilePatterns(auth.AllowedSubjects),
+		sans:     compilePatterns(auth.AllowedSANs),
+	}
+	if auth.CAFile != "" {
+		pool, err := config.LoadCertPool(auth.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		v.pool = pool
+	}
+	return v, nil
+}
+
+// compilePatterns turns patterns where "*" matches any sequence of characters into regular expressions
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, `.*`)
+		compiled = append(compiled, regexp.MustCompile("^"+expr+"$"))
+	}
+	return compiled
+}
+
+// configure applies the client authentication settings to the TLS config of a listener,
+// the certificates are then verified against the CAs during the handshake
+func (v *ClientVerifier) configure(c *tls.Config) {
+	c.ClientAuth = clientAuthTypes[v.auth.ModeOrDefault()]
+	c.ClientCAs = v.pool
+	c.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return nil
+		}
+		return v.checkIdentity(cs.PeerCertificates[0])
+	}
+}
+
+// Verify checks the certificates presented by a client, leaf first, and tells whether they were verified against the CAs
+func (v *ClientVerifier) Verify(certs []*x509.Certificate) (bool, error) {
+	mode := v.auth.ModeOrDefault()
+	if len(certs) == 0 {
+		if mode == config.Require || mode == config.RequireAndVerify {
+			return false, ErrNoClientCertificate
+		}
+		return false, nil
+	}
+
+	leaf := certs[0]
+	verified := false
+	if v.auth.Verifies() {
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         v.pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			return false, fmt.Errorf("client certificate %q: %w", leaf.Subject, err)
+		}
+		verified = true
+	}
+	return verified, v.checkIdentity(leaf)
+}
+
+// checkIdentity checks the subject and the SANs of a certificate against the allowed patterns
+func (v *ClientVerifier) checkIdentity(cert *x509.Certificate) error {
+	if len(v.subjects) > 0 && !matchAny(v.subjects, cert.Subject.CommonName, cert.Subject.String()) {
+		return fmt.Errorf("client certificate subject %q is not allowed", cert.Subject)
+	}
+	if len(v.sans) > 0 && !matchAny(v.sans, sans(cert)...) {
+		return fmt.Errorf("client certificate SANs [%s] are not allowed", strings.Join(sans(cert), ", "))
+	}
+	return nil
+}
+
+func matchAny(patterns []*regexp.Regexp, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if pattern.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sans(cert *x509.Certificate) []string {
+	sans := make([]string, 0)
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return sans
+}
+
+// SetIdentityHeaders sets the headers carrying the identity of the client presenting the certificates,
+// after stripping them from the request so that clients can't forge them
+func SetIdentityHeaders(header http.Header, names config.ClientIdentityHeaders, certs []*x509.Certificate, verified bool) {
+	for _, name := range names.Names() {
+		header.Del(name)
+	}
+	if len(certs) == 0 {
+		return
+	}
+
+	leaf := certs[0]
+	set := func(name, value string) {
+		if name != "" {
+			header.Set(name, value)
+		}
+	}
+	fingerprint := sha256.Sum256(leaf.Raw)
+	set(names.Subject, leaf.Subject.String())
+	set(names.SANs, strings.Join(sans(leaf), ","))
+	set(names.Fingerprint, hex.EncodeToString(fingerprint[:]))
+	set(names.Certificate, url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}))))
+	set(names.Verified, strconv.FormatBool(verified))
+}
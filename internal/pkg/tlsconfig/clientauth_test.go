@@ -0,0 +1,112 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newClientCert issues a client certificate for the given common name and DNS names, signed by a new CA written into dir
+func newClientCert(t *testing.T, dir, commonName string, dnsNames ...string) (caFile string, cert *x509.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDer)
+	require.NoError(t, err)
+	caFile = filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDer}), 0644))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return caFile, cert
+}
+
+func TestClientVerifier_Verify(t *testing.T) {
+	caFile, cert := newClientCert(t, t.TempDir(), "billing", "billing.internal")
+	_, foreign := newClientCert(t, t.TempDir(), "billing", "billing.internal")
+
+	tests := []struct {
+		name     string
+		auth     config.ClientAuth
+		certs    []*x509.Certificate
+		verified bool
+		wantErr  bool
+	}{
+		{"verified", config.ClientAuth{CAFile: caFile}, []*x509.Certificate{cert}, true, false},
+		{"missing certificate", config.ClientAuth{CAFile: caFile}, nil, false, true},
+		{"unknown CA", config.ClientAuth{CAFile: caFile}, []*x509.Certificate{foreign}, false, true},
+		{"optional certificate", config.ClientAuth{CAFile: caFile, Mode: config.VerifyIfGiven}, nil, false, false},
+		{"unverified", config.ClientAuth{Mode: config.Require}, []*x509.Certificate{foreign}, false, false},
+		{"allowed subject", config.ClientAuth{CAFile: caFile, AllowedSubjects: []string{"bill*"}}, []*x509.Certificate{cert}, true, false},
+		{"disallowed subject", config.ClientAuth{CAFile: caFile, AllowedSubjects: []string{"orders"}}, []*x509.Certificate{cert}, false, true},
+		{"allowed SAN", config.ClientAuth{Mode: config.Request, AllowedSANs: []string{"*.internal"}}, []*x509.Certificate{cert}, false, false},
+		{"disallowed SAN", config.ClientAuth{Mode: config.Request, AllowedSANs: []string{"*.example.com"}}, []*x509.Certificate{cert}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewClientVerifier(&tt.auth)
+			require.NoError(t, err)
+			verified, err := verifier.Verify(tt.certs)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.verified, verified)
+		})
+	}
+}
+
+func TestSetIdentityHeaders(t *testing.T) {
+	_, cert := newClientCert(t, t.TempDir(), "billing", "billing.internal")
+	names := config.ClientIdentityHeaders{Subject: "X-Client-Subject", SANs: "X-Client-SANs", Verified: "X-Client-Verified"}
+
+	header := http.Header{}
+	header.Set("X-Client-Subject", "CN=forged")
+	SetIdentityHeaders(header, names, []*x509.Certificate{cert}, true)
+	assert.Equal(t, "CN=billing", header.Get("X-Client-Subject"))
+	assert.Equal(t, "billing.internal", header.Get("X-Client-SANs"))
+	assert.Equal(t, "true", header.Get("X-Client-Verified"))
+
+	// Forged headers are stripped from the requests of clients without certificates
+	header = http.Header{}
+	header.Set("X-Client-Subject", "CN=forged")
+	SetIdentityHeaders(header, names, nil, false)
+	assert.Empty(t, header.Get("X-Client-Subject"))
+}
@@ -0,0 +1,58 @@
+// Package tlsconfig builds the crypto/tls configs used by Mizan from its config
+package tlsconfig
+
+import (
+	"crypto/tls"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+)
+
+// NewServerConfig builds the TLS config of a listener, along with the store of the certificates it serves
+func NewServerConfig(t *config.TLS) (*tls.Config, *CertStore, error) {
+	store, err := NewCertStore(t.Certificates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     t.Version(),
+		CipherSuites:   t.CipherSuiteIDs(),
+		NextProtos:     t.ALPN,
+	}
+	// The listeners serve TLS themselves rather than through net/http, which would otherwise offer these
+	if len(c.NextProtos) == 0 {
+		c.NextProtos = []string{"h2", "http/1.1"}
+	}
+	if t.ClientAuth != nil {
+		verifier, err := NewClientVerifier(t.ClientAuth)
+		if err != nil {
+			return nil, nil, err
+		}
+		verifier.configure(c)
+	}
+	return c, store, nil
+}
+
+// NewClientConfig builds the TLS config of the connections to the https replicas of a service
+func NewClientConfig(u *config.UpstreamTLS) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         u.ServerName,
+		InsecureSkipVerify: u.InsecureSkipVerify,
+	}
+	if u.CAFile != "" {
+		pool, err := config.LoadCertPool(u.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		c.RootCAs = pool
+	}
+	if u.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(u.CertFile, u.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
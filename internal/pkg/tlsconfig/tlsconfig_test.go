@@ -0,0 +1,54 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	serverPair := writeCert(t, dir, "server", "backend.internal")
+	clientPair := writeCert(t, dir, "client", "client.internal")
+
+	// A replica that only accepts the client certificate
+	serverCert, err := tls.LoadX509KeyPair(serverPair.CertFile, serverPair.KeyFile)
+	require.NoError(t, err)
+	clientCAs, err := config.LoadCertPool(clientPair.CertFile)
+	require.NoError(t, err)
+	replica := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	replica.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	replica.StartTLS()
+	defer replica.Close()
+
+	get := func(u *config.UpstreamTLS) error {
+		c, err := NewClientConfig(u)
+		require.NoError(t, err)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: c}}
+		resp, err := client.Get(replica.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	assert.NoError(t, get(&config.UpstreamTLS{
+		CAFile:     serverPair.CertFile,
+		CertFile:   clientPair.CertFile,
+		KeyFile:    clientPair.KeyFile,
+		ServerName: "backend.internal",
+	}))
+	// The replica is reached by its IP, which its certificate doesn't have
+	assert.Error(t, get(&config.UpstreamTLS{CAFile: serverPair.CertFile, CertFile: clientPair.CertFile, KeyFile: clientPair.KeyFile}))
+	assert.Error(t, get(&config.UpstreamTLS{CAFile: serverPair.CertFile, ServerName: "backend.internal"}))
+	assert.NoError(t, get(&config.UpstreamTLS{CertFile: clientPair.CertFile, KeyFile: clientPair.KeyFile, InsecureSkipVerify: true}))
+}
@@ -9,6 +9,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/Mo-Fatah/mizan/internal/cli"
 	"github.com/Mo-Fatah/mizan/internal/mizan"
 )
 
@@ -17,6 +18,11 @@ var (
 )
 
 func main() {
+	// Subcommands such as `mizan validate <file>` don't start the load balancer
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1], os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	flag.Parse()
 
 	// check if the config file exists
@@ -27,6 +33,16 @@ func main() {
 
 	mizan := mizan.NewMizan(*configFile)
 
+	// reload the config on SIGHUP, the same way as when the config file changes
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			log.Info("Received SIGHUP, reloading config...")
+			mizan.Reload()
+		}
+	}()
+
 	// handle interrupts and gracefully shutdown the server
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGINT)
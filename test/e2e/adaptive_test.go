@@ -0,0 +1,68 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathAdaptive = "./testConfigs/adaptive.yml"
+
+// adaptiveMetrics returns the metrics served by the admin API of the adaptive config
+func adaptiveMetrics(t *testing.T) string {
+	resp, err := http.Get("http://127.0.0.1:9904/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	metrics, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(metrics)
+}
+
+// Requests over the adaptive concurrency limit should be shed, the limit shrinking as the replica is too slow.
+// The limit should be kept across reloads that don't change the concurrency of the service.
+func TestE2E_AdaptiveConcurrency(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9212",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("done"))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	path := filepath.Join(t.TempDir(), "adaptive.yml")
+	require.NoError(t, copyFile(yamlPathAdaptive, path))
+	defer startMizan(t, path).ShutDown()
+
+	statuses := make(chan int, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			resp, err := http.Get("http://localhost:8108/adaptive")
+			if !assert.NoError(t, err) {
+				statuses <- 0
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	counts := make(map[int]int)
+	for i := 0; i < 5; i++ {
+		counts[<-statuses]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 2, http.StatusServiceUnavailable: 3}, counts, "the initial limit lets 2 requests in")
+
+	assert.Contains(t, adaptiveMetrics(t), `mizan_service_concurrency_limit{service="adaptive"} 1`, "the slow requests shrank the limit")
+
+	reloadConfig(t, "127.0.0.1:9904", path, `strategy: "rr"`, `strategy: "wrr"`)
+	assert.Contains(t, adaptiveMetrics(t), `mizan_service_concurrency_limit{service="adaptive"} 1`, "the limit is kept")
+
+	reloadConfig(t, "127.0.0.1:9904", path, "initial_limit: 2", "initial_limit: 3")
+	assert.Contains(t, adaptiveMetrics(t), `mizan_service_concurrency_limit{service="adaptive"} 3`, "the limit starts over")
+}
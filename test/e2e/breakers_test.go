@@ -0,0 +1,139 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	yamlPathBreakers       = "./testConfigs/breakers.yml"
+	yamlPathBreakersReload = "./testConfigs/breakers_reload.yml"
+)
+
+// startFailingReplica starts a replica answering with its port, or with 500 while failing is set
+func startFailingReplica(port int, failing *atomic.Bool) *http.Server {
+	replica := &http.Server{
+		Addr: fmt.Sprintf(":%d", port),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			fmt.Fprint(w, port)
+		}),
+	}
+	go replica.ListenAndServe()
+	return replica
+}
+
+// A replica failing its requests while passing its health checks should be left out by its circuit breaker
+// until it recovers
+func TestE2E_CircuitBreakers(t *testing.T) {
+	failing := &atomic.Bool{}
+	failing.Store(true)
+	defer startFailingReplica(9208, failing).Close()
+	defer startFailingReplica(9209, &atomic.Bool{}).Close()
+
+	defer startMizan(t, yamlPathBreakers).ShutDown()
+
+	get := func() (int, string) {
+		resp, err := http.Get("http://localhost:8105/flaky")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	failures := 0
+	for i := 0; i < 10; i++ {
+		if status, _ := get(); status == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	assert.Equal(t, 2, failures, "the breaker opens after 2 consecutive failures")
+
+	resp, err := http.Get("http://127.0.0.1:9903/breakers")
+	require.NoError(t, err)
+	var breakers map[string]map[string]struct {
+		State string `json:"state"`
+		Trips int64  `json:"trips"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&breakers))
+	resp.Body.Close()
+	assert.Equal(t, "open", breakers["flaky"]["http://localhost:9208"].State)
+	assert.Equal(t, int64(1), breakers["flaky"]["http://localhost:9208"].Trips)
+	assert.Equal(t, "closed", breakers["flaky"]["http://localhost:9209"].State)
+
+	resp, err = http.Get("http://127.0.0.1:9903/metrics")
+	require.NoError(t, err)
+	metrics, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Contains(t, string(metrics), fmt.Sprintf(`mizan_circuit_breaker_state{service="flaky",replica="http://localhost:9208"} %d`, breaker.Open))
+	assert.Contains(t, string(metrics), `mizan_replica_up{service="flaky",replica="http://localhost:9208"} 1`)
+
+	// Once the open timeout elapsed, a successful probe closes the breaker
+	failing.Store(false)
+	time.Sleep(1100 * time.Millisecond)
+	answers := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		status, body := get()
+		assert.Equal(t, http.StatusOK, status)
+		answers[body] = true
+	}
+	assert.Equal(t, map[string]bool{"9208": true, "9209": true}, answers)
+}
+
+// The circuit breakers should be kept across reloads that don't change them, so that a reload
+// doesn't send traffic back to failing replicas
+func TestE2E_CircuitBreakersKeptAcrossReloads(t *testing.T) {
+	failing := &atomic.Bool{}
+	failing.Store(true)
+	defer startFailingReplica(9208, failing).Close()
+	defer startFailingReplica(9209, &atomic.Bool{}).Close()
+
+	path := filepath.Join(t.TempDir(), "breakers.yml")
+	require.NoError(t, copyFile(yamlPathBreakersReload, path))
+	defer startMizan(t, path).ShutDown()
+
+	statuses := func() map[int]int {
+		statuses := make(map[int]int)
+		for i := 0; i < 10; i++ {
+			resp, err := http.Get("http://localhost:8111/flaky")
+			require.NoError(t, err)
+			resp.Body.Close()
+			statuses[resp.StatusCode]++
+		}
+		return statuses
+	}
+	state := func() string {
+		resp, err := http.Get("http://127.0.0.1:9906/breakers")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var breakers map[string]map[string]struct {
+			State string `json:"state"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&breakers))
+		return breakers["flaky"]["http://localhost:9208"].State
+	}
+
+	assert.Equal(t, map[int]int{http.StatusOK: 8, http.StatusInternalServerError: 2}, statuses())
+	assert.Equal(t, "open", state())
+
+	reloadConfig(t, "127.0.0.1:9906", path, `name: "other"`, `name: "renamed"`)
+	assert.Equal(t, "open", state(), "the breaker is kept by a reload changing another service")
+	assert.Equal(t, map[int]int{http.StatusOK: 10}, statuses())
+
+	reloadConfig(t, "127.0.0.1:9906", path, "consecutive_failures: 2", "consecutive_failures: 3")
+	assert.Equal(t, "closed", state(), "the breaker starts over with its new config")
+}
@@ -0,0 +1,57 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var yamlPathConcurrency = "./testConfigs/concurrency.yml"
+
+// Requests over the concurrency limits of their service should wait in its queue, and be answered with 503
+// when the queue is full or they waited for too long
+func TestE2E_Concurrency(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9211",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("done"))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	defer startMizan(t, yamlPathConcurrency).ShutDown()
+
+	for _, tt := range []struct {
+		path     string
+		statuses []int
+	}{
+		// The second request waits for the first one, the third one finds the queue full
+		{"/queued", []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable}},
+		// The second request gives up waiting before the first one is done
+		{"/timeout", []int{http.StatusOK, http.StatusServiceUnavailable}},
+	} {
+		statuses := make(chan int, len(tt.statuses))
+		got := make([]int, len(tt.statuses))
+		for range tt.statuses {
+			go func(path string) {
+				resp, err := http.Get("http://localhost:8107" + path)
+				if !assert.NoError(t, err) {
+					statuses <- 0
+					return
+				}
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}(tt.path)
+			// The requests come in order
+			time.Sleep(50 * time.Millisecond)
+		}
+		for i := range got {
+			got[i] = <-statuses
+		}
+		assert.ElementsMatch(t, tt.statuses, got, tt.path)
+	}
+}
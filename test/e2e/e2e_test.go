@@ -1,6 +1,7 @@
 package e2e
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/Mo-Fatah/mizan/internal/mizan"
 	testservice "github.com/Mo-Fatah/mizan/test/testutil/testservices"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TODO (Mo-Fatah): Add tests for the following:
@@ -35,7 +37,7 @@ var (
 // Round Robin should rotate on the servers in the order they are defined in the config
 // So if we have 3 servers, the first request should go to the first server, the second to the second server and so on
 func TestE2E_BasicRoundRobin(t *testing.T) {
-	envSetup(defaultReplicas, yamlPathRR)
+	envSetup(t, defaultReplicas, yamlPathRR)
 	defer tearDown()
 
 	ports := []int{9090, 9091, 9092}
@@ -61,7 +63,7 @@ func TestE2E_BasicRoundRobin(t *testing.T) {
 // Weighted Round Robin should rotate on the servers considering their weights
 // So if we have 2 servers with weights 2 and 1, the first 2 requests should go to the first server and the third to the second server
 func TestE2E_BasicWeightedRoundRobin(t *testing.T) {
-	envSetup(defaultReplicas, yamlPathWRR)
+	envSetup(t, defaultReplicas, yamlPathWRR)
 	defer tearDown()
 
 	portsFreq := map[int]int{
@@ -92,7 +94,7 @@ func TestE2E_BasicWeightedRoundRobin(t *testing.T) {
 
 func TestE2E_WhenAServiceisDownRR(t *testing.T) {
 	// The yaml file has 3 replicas, but we will start only 2 to simulate a down service
-	envSetup(2, yamlPathRR)
+	envSetup(t, 2, yamlPathRR)
 	defer tearDown()
 
 	ports := []int{9090, 9091}
@@ -120,7 +122,7 @@ func TestE2E_HotReload(t *testing.T) {
 	// start with Round Robin config
 	copyFile(yamlPathRR, yamlPathHotReload)
 
-	envSetup(defaultReplicas, yamlPathHotReload)
+	envSetup(t, defaultReplicas, yamlPathHotReload)
 	defer tearDown()
 
 	ports := []int{9090, 9091, 9092}
@@ -144,6 +146,9 @@ func TestE2E_HotReload(t *testing.T) {
 	time.Sleep(4 * time.Second)
 	// change the config to Weighted Round Robin
 	copyFile(yamlPathWRR, yamlPathHotReload)
+	// Reloading happens asynchronously once the watcher sees the file change, and the new config is validated
+	// and diffed against the current one before being applied. Give Mizan time to pick it up.
+	time.Sleep(time.Second)
 
 	portsFreq := map[int]int{
 		9090: 0,
@@ -171,18 +176,89 @@ func TestE2E_HotReload(t *testing.T) {
 	assert.Equal(t, portsFreq[9092], 1)
 }
 
-func envSetup(replicas int, yamlPath string) {
+// Editors and Kubernetes ConfigMaps replace the config file through a rename instead of writing to it
+func TestE2E_HotReloadAtomicRename(t *testing.T) {
+	copyFile(yamlPathRR, yamlPathHotReload)
+
+	envSetup(t, defaultReplicas, yamlPathHotReload)
+	defer tearDown()
+
+	// Replace the file twice to make sure the watcher survives a rename
+	for _, yamlPath := range []string{yamlPathRR, yamlPathWRR} {
+		tmpPath := yamlPathHotReload + ".tmp"
+		copyFile(yamlPath, tmpPath)
+		assert.NoError(t, os.Rename(tmpPath, yamlPathHotReload))
+		time.Sleep(time.Second)
+	}
+
+	portsFreq := map[int]int{
+		9090: 0,
+		9091: 0,
+		9092: 0,
+	}
+
+	for i := 0; i < 10; i++ {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d%s", (i%3)+8080, "/api/v1"))
+		assert.NoError(t, err)
+		assert.Equal(t, resp.StatusCode, 200)
+
+		body := make([]byte, 100)
+		resp.Body.Read(body)
+		// Remove null bytes from the body
+		bodyStr := strings.Trim(string(body), "\x00")
+		assert.True(t, strings.Contains(bodyStr, "OK"))
+
+		servicePort, err := strconv.Atoi(strings.Split(bodyStr, " ")[2])
+		assert.NoError(t, err)
+		portsFreq[servicePort]++
+	}
+	assert.Equal(t, portsFreq[9090], 6)
+	assert.Equal(t, portsFreq[9091], 3)
+	assert.Equal(t, portsFreq[9092], 1)
+}
+
+func envSetup(t *testing.T, replicas int, yamlPath string) {
 	dsg = testservice.NewDummyServiceGen(replicas)
 	dsg.Start()
 	for !dsg.IsReady() {
 		continue
 	}
 
-	mizanServer = mizan.NewMizan(yamlPath)
+	mizanServer = startMizan(t, yamlPath)
+}
+
+// startMizan starts Mizan with the given config, returning once it listens and the replicas of its services have been
+// health checked, so that the replicas that are up are alive. The caller shuts it down.
+func startMizan(t *testing.T, yamlPath string) *mizan.Mizan {
+	mizanServer := mizan.NewMizan(yamlPath)
 	go mizanServer.Start()
-	for !mizanServer.IsReady() {
-		continue
+	for start := time.Now(); !mizanServer.IsReady() || !mizanServer.IsHealthChecked(); {
+		if time.Since(start) > 5*time.Second {
+			mizanServer.ShutDown()
+			t.Fatalf("mizan with config %s did not start", yamlPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return mizanServer
+}
+
+// reloadConfig rewrites a config with a replacement applied, and waits for Mizan to apply it
+// by watching the config history of its admin API
+func reloadConfig(t *testing.T, admin, path, old, new string) {
+	snapshots := func() int {
+		resp, err := http.Get("http://" + admin + "/config/history")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var snapshots []json.RawMessage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&snapshots))
+		return len(snapshots)
 	}
+	applied := snapshots()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), old)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0644))
+	require.Eventually(t, func() bool { return snapshots() > applied }, 3*time.Second, 20*time.Millisecond)
 }
 
 func copyFile(src, dst string) error {
@@ -218,3 +294,12 @@ func tearDown() {
 	mizanServer.ShutDown()
 	dsg.Stop()
 }
+
+// Shutting Mizan down again, e.g. on a signal received while it shuts down, should be a no-op
+func TestE2E_ShutDownTwice(t *testing.T) {
+	envSetup(t, defaultReplicas, yamlPathRR)
+	defer dsg.Stop()
+
+	assert.True(t, mizanServer.ShutDown())
+	assert.False(t, mizanServer.ShutDown())
+}
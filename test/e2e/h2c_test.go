@@ -0,0 +1,131 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var yamlPathH2C = "./testConfigs/h2c.yml"
+
+// h2cClient speaks cleartext HTTP/2 with prior knowledge
+var h2cClient = &http.Client{Transport: &http2.Transport{
+	AllowHTTP: true,
+	DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	},
+}}
+
+// startH2CReplica starts a replica serving h2c, which answers with its port and the protocol of the request,
+// followed by a grpc-status trailer
+func startH2CReplica(port int) *http.Server {
+	replica := &http.Server{
+		Addr: fmt.Sprintf(":%d", port),
+		Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(fmt.Sprintf("OK from %d over HTTP/%d", port, r.ProtoMajor)))
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		}), &http2.Server{}),
+	}
+	go replica.ListenAndServe()
+	for {
+		if conn, err := net.Dial("tcp", replica.Addr); err == nil {
+			conn.Close()
+			return replica
+		}
+	}
+}
+
+// Cleartext HTTP/2 should be spoken end to end, from the client to Mizan and from Mizan to the replica,
+// with the trailers of the replica forwarded to the client as gRPC needs them
+func TestE2E_H2C(t *testing.T) {
+	defer startH2CReplica(9190).Close()
+	defer startH2CReplica(9191).Close()
+	defer startMizan(t, yamlPathH2C).ShutDown()
+
+	resp, err := h2cClient.Get("http://localhost:8090/h2c")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "OK from 9190 over HTTP/2", string(body))
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+}
+
+// gRPC calls should be routed by method, falling back to their service,
+// and failures should be reported as gRPC statuses
+func TestE2E_GRPCRouting(t *testing.T) {
+	defer startH2CReplica(9190).Close()
+	defer startH2CReplica(9191).Close()
+	defer startMizan(t, yamlPathH2C).ShutDown()
+
+	call := func(method string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:8090"+method, bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		resp, err := h2cClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := call("/helloworld.Greeter/SayHello")
+	assert.Equal(t, "OK from 9190 over HTTP/2", body)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+	resp, body = call("/helloworld.Greeter/SayGoodbye")
+	assert.Equal(t, "OK from 9191 over HTTP/2", body)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+	resp, body = call("/helloworld.Unknown/SayHello")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "12", resp.Header.Get("Grpc-Status"))
+	assert.Empty(t, body)
+}
+
+// gRPC calls to a service whose replicas are all down should fail with UNAVAILABLE
+func TestE2E_GRPCUnavailable(t *testing.T) {
+	defer startMizan(t, yamlPathH2C).ShutDown()
+	// The connections of the previous tests outlive their Mizan, whose h2c connections aren't closed on shutdown
+	h2cClient.CloseIdleConnections()
+
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8090/helloworld.Greeter/SayHello", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := h2cClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+	// A trailers-only response, whose trailers are sent along with the headers
+	assert.Equal(t, "14", resp.Header.Get("Grpc-Status"))
+	assert.Equal(t, "Service%20Unavailable", resp.Header.Get("Grpc-Message"))
+	assert.Empty(t, body)
+
+	// Plain HTTP clients get the HTTP status
+	resp, err = h2cClient.Get("http://localhost:8090/h2c")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
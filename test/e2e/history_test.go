@@ -0,0 +1,88 @@
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyConfig is a config serving /history from the replica on the given port
+func historyConfig(port int) string {
+	return fmt.Sprintf(`strategy: "rr"
+max_connections: 1024
+admin:
+  address: "127.0.0.1:9905"
+ports:
+  - 8110
+services:
+  - matcher: "/history"
+    name: "history"
+    replicas:
+      - url: "http://localhost:%d"
+`, port)
+}
+
+// Rolling back should re-apply the config of a snapshot as a new snapshot, and unknown snapshots should be reported
+func TestE2E_HistoryRollback(t *testing.T) {
+	for _, port := range []int{9214, 9215} {
+		replica := &http.Server{
+			Addr: fmt.Sprintf(":%d", port),
+			Handler: http.HandlerFunc(func(port int) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprintf(w, "OK from %d", port)
+				}
+			}(port)),
+		}
+		go replica.ListenAndServe()
+		defer replica.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "history.yml")
+	require.NoError(t, os.WriteFile(path, []byte(historyConfig(9214)), 0644))
+	defer startMizan(t, path).ShutDown()
+
+	get := func() string {
+		resp, err := http.Get("http://localhost:8110/history")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	assert.Equal(t, "OK from 9214", get())
+
+	require.NoError(t, os.WriteFile(path, []byte(historyConfig(9215)), 0644))
+	assert.Eventually(t, func() bool { return get() == "OK from 9215" }, 3*time.Second, 50*time.Millisecond)
+
+	var stdout, stderr bytes.Buffer
+	code := cli.Run("history", []string{"-admin", "127.0.0.1:9905", "rollback", "1"}, &stdout, &stderr)
+	assert.Equal(t, cli.ExitOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "Rolled back, the live config is now snapshot 3")
+	assert.Eventually(t, func() bool { return get() == "OK from 9214" }, 3*time.Second, 50*time.Millisecond)
+
+	stdout.Reset()
+	code = cli.Run("history", []string{"-admin", "127.0.0.1:9905", "list"}, &stdout, &stderr)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout.String(), "rollback to snapshot 1")
+
+	resp, err := http.Post("http://127.0.0.1:9905/config/history/42/rollback", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	stdout.Reset()
+	stderr.Reset()
+	code = cli.Run("history", []string{"-admin", "127.0.0.1:9905", "rollback", "42"}, &stdout, &stderr)
+	assert.Equal(t, cli.ExitInvalid, code)
+	assert.Equal(t, "admin API: snapshot not found\n", stderr.String())
+	assert.Equal(t, "OK from 9214", get())
+}
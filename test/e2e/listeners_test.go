@@ -0,0 +1,47 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathListeners = "./testConfigs/listeners.yml"
+
+// Services should only be reachable on the listeners exposing them
+func TestE2E_ListenerServices(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9203",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello from " + r.URL.Path))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	defer startMizan(t, yamlPathListeners).ShutDown()
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"http://127.0.0.1:8101/public", http.StatusOK},
+		{"http://127.0.0.1:8101/internal", http.StatusNotFound},
+		{"http://127.0.0.1:8102/public", http.StatusOK},
+		{"http://127.0.0.1:8102/internal", http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(tt.url)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.url)
+		if tt.status == http.StatusOK {
+			assert.Contains(t, string(body), "hello from /")
+		}
+	}
+}
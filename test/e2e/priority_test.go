@@ -0,0 +1,73 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var yamlPathPriority = "./testConfigs/priority.yml"
+
+// Requests of the lowest priorities should be shed first, when max_connections is nearly reached
+// and from the queue of an overloaded service
+func TestE2E_Priority(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9213",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("done"))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	defer startMizan(t, yamlPathPriority).ShutDown()
+
+	type request struct {
+		path     string
+		priority string
+	}
+	for _, tt := range []struct {
+		name     string
+		requests []request
+		statuses []int
+	}{
+		{
+			// Batch requests can only use half of max_connections, the rest is left to critical requests
+			name:     "max connections",
+			requests: []request{{"/global", "batch"}, {"/global", "batch"}, {"/global", "batch"}, {"/global", "critical"}},
+			statuses: []int{http.StatusOK, http.StatusOK, http.StatusServiceUnavailable, http.StatusOK},
+		},
+		{
+			// The batch request waiting in the full queue is evicted by the second critical request
+			name:     "queue",
+			requests: []request{{"/queued", "critical"}, {"/queued", "batch"}, {"/queued", ""}},
+			statuses: []int{http.StatusOK, http.StatusServiceUnavailable, http.StatusOK},
+		},
+	} {
+		statuses := make([]chan int, len(tt.requests))
+		for i, req := range tt.requests {
+			statuses[i] = make(chan int, 1)
+			go func(req request, status chan int) {
+				r, _ := http.NewRequest(http.MethodGet, "http://localhost:8109"+req.path, nil)
+				if req.priority != "" {
+					r.Header.Set("X-Priority", req.priority)
+				}
+				resp, err := http.DefaultClient.Do(r)
+				if !assert.NoError(t, err) {
+					status <- 0
+					return
+				}
+				resp.Body.Close()
+				status <- resp.StatusCode
+			}(req, statuses[i])
+			// The requests come in order
+			time.Sleep(50 * time.Millisecond)
+		}
+		for i, status := range statuses {
+			assert.Equal(t, tt.statuses[i], <-status, "%s: request %d", tt.name, i)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package e2e
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/proxyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathProxyProto = "./testConfigs/proxyproto.yml"
+
+// startProxyProtoReplica starts a TCP replica answering the client address of the PROXY protocol header
+// its connections start with, followed by what it receives
+func startProxyProtoReplica(t *testing.T, port int) net.Listener {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				header, err := proxyproto.Read(r)
+				if err != nil {
+					// e.g. a health check
+					return
+				}
+				received, _ := io.ReadAll(r)
+				conn.Write([]byte(fmt.Sprintf("%s %s", header.Source, received)))
+			}()
+		}
+	}()
+	return ln
+}
+
+// The address of the clients sent by a load balancer in PROXY protocol headers should be the one
+// the HTTP replicas are given, and the one sent on to the TCP replicas
+func TestE2E_ProxyProtocol(t *testing.T) {
+	httpReplica := &http.Server{
+		Addr: ":9201",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("X-Forwarded-For")))
+		}),
+	}
+	go httpReplica.ListenAndServe()
+	defer httpReplica.Close()
+	defer startProxyProtoReplica(t, 9202).Close()
+
+	defer startMizan(t, yamlPathProxyProto).ShutDown()
+
+	conn, err := net.Dial("tcp", "localhost:8098")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 192.0.2.1 127.0.0.1 56324 8098\r\nGET /client HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "192.0.2.1", string(body))
+
+	// Trusted sources must send the header
+	conn, err = net.Dial("tcp", "localhost:8098")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /client HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.Error(t, err)
+
+	conn, err = net.Dial("tcp", "localhost:8099")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 198.51.100.7 127.0.0.1 40000 8099\r\nhello"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	answer, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.7:40000 hello", string(answer))
+}
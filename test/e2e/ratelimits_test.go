@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathRateLimits = "./testConfigs/ratelimits.yml"
+
+// Requests over the rate limit of their API key should be answered with 429, other keys being unaffected
+func TestE2E_RateLimits(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9210",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	defer startMizan(t, yamlPathRateLimits).ShutDown()
+
+	get := func(apiKey string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:8106/limited", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Api-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		resp := get("a")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+		assert.Equal(t, []string{"1", "0"}[i], resp.Header.Get("RateLimit-Remaining"))
+	}
+	resp := get("a")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	assert.Equal(t, "60", resp.Header.Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, get("b").StatusCode)
+}
@@ -0,0 +1,114 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathRetries = "./testConfigs/retries.yml"
+
+// startRetryReplicas starts a replica always unavailable, a replica answering the body of the requests,
+// and a replica closing the connections of the requests without answering
+func startRetryReplicas(t *testing.T) func() {
+	unavailable := &http.Server{
+		Addr: ":9205",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Replica", "unavailable")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	}
+	echo := &http.Server{
+		Addr: ":9206",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+		}),
+	}
+	reset := &http.Server{
+		Addr: ":9207",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+		}),
+	}
+	for _, server := range []*http.Server{unavailable, echo, reset} {
+		go server.ListenAndServe()
+	}
+	return func() {
+		unavailable.Close()
+		echo.Close()
+		reset.Close()
+	}
+}
+
+// Requests failing on a replica should be retried on another, with their body replayed
+func TestE2E_Retries(t *testing.T) {
+	defer startRetryReplicas(t)()
+
+	defer startMizan(t, yamlPathRetries).ShutDown()
+
+	send := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, "http://localhost:8104"+path, strings.NewReader("payload"))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	for _, path := range []string{"/retried", "/reset"} {
+		for i := 0; i < 4; i++ {
+			resp := send(path)
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+			assert.Equal(t, "payload", string(body), path)
+			assert.Empty(t, resp.Header.Get("X-Replica"), "the headers of the dropped response don't leak")
+		}
+	}
+
+	statuses := make(map[int]int)
+	for i := 0; i < 4; i++ {
+		resp := send("/not-retried")
+		resp.Body.Close()
+		statuses[resp.StatusCode]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 2, http.StatusServiceUnavailable: 2}, statuses)
+}
+
+// A replica picked again for a retry that finds no other replica should be given back,
+// rather than kept busy for good
+func TestE2E_RetriesGiveBackReplicas(t *testing.T) {
+	// The replica on 9217 isn't started, the retries of the requests the first replica fails find no other one
+	var answered int32
+	flaky := &http.Server{
+		Addr: ":9216",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&answered, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}),
+	}
+	go flaky.ListenAndServe()
+	defer flaky.Close()
+
+	defer startMizan(t, yamlPathRetries).ShutDown()
+
+	get := func() int {
+		resp, err := http.Get("http://localhost:8104/busy")
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, get())
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, get())
+	}
+}
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathTCP = "./testConfigs/tcp.yml"
+
+// startTCPEchoReplica starts a replica answering what it receives prefixed by its port, once the client is done sending
+func startTCPEchoReplica(t *testing.T, port int) net.Listener {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				received, _ := io.ReadAll(conn)
+				conn.Write([]byte(fmt.Sprintf("%d: %s", port, received)))
+			}()
+		}
+	}()
+	return ln
+}
+
+// tcpCounters returns the counters of the TCP connections by replica, as served by the admin API
+func tcpCounters(t *testing.T) map[string]l4.Counters {
+	resp, err := http.Get("http://127.0.0.1:9901/connections/tcp")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var counters map[string]l4.Counters
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&counters))
+	return counters
+}
+
+// TCP connections should be balanced across the replicas and spliced to them, half closes included
+func TestE2E_TCP(t *testing.T) {
+	defer startTCPEchoReplica(t, 9196).Close()
+	defer startTCPEchoReplica(t, 9197).Close()
+
+	defer startMizan(t, yamlPathTCP).ShutDown()
+	// The connections made by IsReady have been balanced as well, they're done once they're closed by the replicas
+	require.Eventually(t, func() bool {
+		for _, replicaCounters := range tcpCounters(t) {
+			if replicaCounters.Active > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	answers := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", "localhost:8096")
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+		answer, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		answers = append(answers, string(answer))
+		conn.Close()
+	}
+	// The replicas take turns from wherever the connections made by IsReady left them
+	first, second := "9196: hello", "9197: hello"
+	if answers[0] == second {
+		first, second = second, first
+	}
+	assert.Equal(t, []string{first, second, first, second}, answers)
+
+	counters := tcpCounters(t)
+	for _, replica := range []string{"tcp://localhost:9196", "tcp://localhost:9197"} {
+		assert.Equal(t, int64(10), counters[replica].BytesIn, replica)
+		assert.GreaterOrEqual(t, counters[replica].BytesOut, int64(22), replica)
+	}
+
+	// Idle connections are closed
+	conn, err := net.Dial("tcp", "localhost:8096")
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,49 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathTimeouts = "./testConfigs/timeouts.yml"
+
+// Requests to replicas too slow for the timeouts of their service should be answered with 504
+func TestE2E_ServiceTimeouts(t *testing.T) {
+	replica := &http.Server{
+		Addr: ":9204",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/fast" {
+				select {
+				case <-time.After(2 * time.Second):
+				case <-r.Context().Done():
+				}
+			}
+			w.Write([]byte("done"))
+		}),
+	}
+	go replica.ListenAndServe()
+	defer replica.Close()
+
+	defer startMizan(t, yamlPathTimeouts).ShutDown()
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/slow-headers", http.StatusGatewayTimeout},
+		{"/slow-total", http.StatusGatewayTimeout},
+		{"/fast", http.StatusOK},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		resp, err := http.Get("http://localhost:8103" + tt.path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tt.status, resp.StatusCode, tt.path)
+		assert.Less(t, time.Since(start), time.Second, tt.path)
+	}
+}
@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mo-Fatah/mizan/internal/pkg/l4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathUDP = "./testConfigs/udp.yml"
+
+// startUDPEchoReplica starts a replica answering each datagram prefixed by its port
+func startUDPEchoReplica(t *testing.T, port int) net.PacketConn {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	require.NoError(t, err)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo([]byte(fmt.Sprintf("%d: %s", port, buf[:n])), addr)
+		}
+	}()
+	return conn
+}
+
+// exchange sends a datagram through Mizan until it's answered, since Mizan may not be ready yet
+func exchange(t *testing.T, conn net.Conn, message string) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		_, err := conn.Write([]byte(message))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if n, err := conn.Read(buf); err == nil {
+			return string(buf[:n])
+		}
+	}
+	t.Fatalf("no answer to %q", message)
+	return ""
+}
+
+// Clients should keep being answered by the replica their session has been assigned, clients of the same IP
+// should be assigned the same replica, clients should be spread across the alive replicas, and idle sessions should expire
+func TestE2E_UDP(t *testing.T) {
+	defer startUDPEchoReplica(t, 9198).Close()
+	defer startUDPEchoReplica(t, 9199).Close()
+
+	defer startMizan(t, yamlPathUDP).ShutDown()
+
+	replicas := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		// Every client has its own loopback IP, and a second source port of the same IP
+		client := &net.UDPAddr{IP: net.IPv4(127, 0, 0, byte(i+1))}
+		conn, err := net.DialUDP("udp", client, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8097})
+		require.NoError(t, err)
+		first := exchange(t, conn, "hello")
+		port, _, _ := strings.Cut(first, ": ")
+		replicas[port]++
+		assert.Equal(t, port+": again", exchange(t, conn, "again"))
+		conn.Close()
+
+		conn, err = net.DialUDP("udp", client, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8097})
+		require.NoError(t, err)
+		assert.Equal(t, port+": hello", exchange(t, conn, "hello"))
+		conn.Close()
+	}
+	assert.Len(t, replicas, 2)
+	assert.NotContains(t, replicas, "9200")
+
+	time.Sleep(2 * time.Second)
+	resp, err := http.Get("http://127.0.0.1:9902/connections/udp")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var counters map[string]l4.Counters
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&counters))
+	total := int64(0)
+	for _, replicaCounters := range counters {
+		assert.Equal(t, int64(0), replicaCounters.Active)
+		total += replicaCounters.Total
+	}
+	assert.Equal(t, int64(20), total)
+}
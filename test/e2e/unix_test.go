@@ -0,0 +1,68 @@
+package e2e
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathUnix = "./testConfigs/unix.yml"
+
+// Requests should be accepted on a Unix domain socket and proxied to a replica listening on another
+func TestE2E_Unix(t *testing.T) {
+	replicaSocket := "/tmp/mizan-e2e-replica.sock"
+	os.Remove(replicaSocket)
+	ln, err := net.Listen("unix", replicaSocket)
+	require.NoError(t, err)
+	replica := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello from " + r.URL.Path))
+		}),
+	}
+	go replica.Serve(ln)
+	defer replica.Close()
+
+	// The socket left behind by a previous run is replaced
+	os.Remove("/tmp/mizan-e2e.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: "/tmp/mizan-e2e.sock", Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	mizanServer := startMizan(t, yamlPathUnix)
+
+	info, err := os.Stat("/tmp/mizan-e2e.sock")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	// The private directory the socket was created in is gone
+	dirs, err := filepath.Glob("/tmp/.mizan*")
+	require.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", "/tmp/mizan-e2e.sock")
+			},
+		},
+	}
+	resp, err := client.Get("http://localhost/unix")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello from /unix", string(body))
+
+	mizanServer.ShutDown()
+	_, err = os.Stat("/tmp/mizan-e2e.sock")
+	assert.True(t, os.IsNotExist(err), "the socket is removed on shutdown")
+}
@@ -0,0 +1,76 @@
+package e2e
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var yamlPathUpgrade = "./testConfigs/upgrade.yml"
+
+// echoReplica upgrades connections to a protocol echoing back the lines it receives
+func echoReplica(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	rw.Flush()
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		rw.WriteString(line)
+		rw.Flush()
+	}
+}
+
+// Upgraded connections should outlive the timeouts of HTTP requests as long as there's traffic,
+// and be closed once they're idle
+func TestE2E_Upgrade(t *testing.T) {
+	replica := &http.Server{Addr: ":9195", Handler: http.HandlerFunc(echoReplica)}
+	go replica.ListenAndServe()
+	defer replica.Close()
+	for {
+		if conn, err := net.Dial("tcp", replica.Addr); err == nil {
+			conn.Close()
+			break
+		}
+	}
+
+	defer startMizan(t, yamlPathUpgrade).ShutDown()
+
+	conn, err := net.Dial("tcp", "localhost:8095")
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	// Past the 5s write timeout of HTTP requests
+	for start := time.Now(); time.Since(start) < 6*time.Second; {
+		_, err := conn.Write([]byte("ping\n"))
+		require.NoError(t, err)
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "ping\n", line)
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	// Past the idle timeout
+	time.Sleep(1500 * time.Millisecond)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
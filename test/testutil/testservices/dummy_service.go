@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 )
 
 const (
@@ -18,6 +19,7 @@ type Service interface {
 
 type DummyService struct {
 	ch   chan struct{}
+	wg   *sync.WaitGroup
 	Port int
 }
 
@@ -33,10 +35,16 @@ func (ds *DummyService) Run() error {
 		Handler: ds,
 	}
 
+	done := make(chan struct{})
 	go func() {
-		<-ds.ch
-		server.Shutdown(context.TODO())
+		defer ds.wg.Done()
+		select {
+		case <-ds.ch:
+			server.Shutdown(context.TODO())
+		case <-done:
+		}
 	}()
+	defer close(done)
 
 	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		return err
@@ -47,12 +55,15 @@ func (ds *DummyService) Run() error {
 type DummyServiceGen struct {
 	replicas int
 	ch       chan struct{}
+	// wg is used to wait for all the dummy services to release their ports on Stop
+	wg *sync.WaitGroup
 }
 
 func NewDummyServiceGen(replicas int) *DummyServiceGen {
 	return &DummyServiceGen{
 		replicas: replicas,
 		ch:       make(chan struct{}),
+		wg:       &sync.WaitGroup{},
 	}
 }
 
@@ -66,16 +77,20 @@ func (dsg *DummyServiceGen) IsReady() bool {
 	return true
 }
 
+// Stop shuts the dummy services down, returning once they released their ports so that the next test can listen on them
 func (dsg *DummyServiceGen) Stop() {
 	close(dsg.ch)
+	dsg.wg.Wait()
 }
 
 func (dsg *DummyServiceGen) Start() {
 	for i := 0; i < dsg.replicas; i++ {
 		ds := &DummyService{
 			ch:   dsg.ch,
+			wg:   dsg.wg,
 			Port: BASE_PORT + i,
 		}
+		dsg.wg.Add(1)
 		go ds.Run()
 	}
 }